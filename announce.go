@@ -0,0 +1,273 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	announcePost    = "post"
+	announceRolling = "rolling"
+
+	// announceBatchDelay is how long we collect joins and leaves before announcing them, so mass joins end up in a
+	// single message and members reconnecting are not announced at all
+	announceBatchDelay = 5 * time.Second
+	// maxRollingLines is the amount of announcements kept in a rolling message
+	maxRollingLines = 10
+
+	defaultJoinTemplate  = "{user} joined {voice}"
+	defaultLeaveTemplate = "{user} left {voice}"
+)
+
+// announcementBatch contains the joins and leaves of a voice channel that have not been announced yet
+type announcementBatch struct {
+	guildID snowflake
+	order   []snowflake        // The users in the order of their first join or leave
+	before  map[snowflake]bool // Whether the user was in voice before this batch
+	after   map[snowflake]bool // Whether the user is in voice now
+}
+
+// rollingAnnouncement is the message we keep editing with new announcements
+type rollingAnnouncement struct {
+	messageID snowflake
+	lines     []string
+}
+
+var (
+	announceMutex sync.Mutex
+	// announceBatches contains the pending announcements, the key is the voice channel ID
+	announceBatches = make(map[snowflake]*announcementBatch)
+	// rollingMessages contains the rolling announcement of each voice channel, the key is the voice channel ID
+	rollingMessages = make(map[snowflake]*rollingAnnouncement)
+)
+
+func init() {
+	registerLinkOption(&linkOption{
+		name:        "announce",
+		description: "`post` to announce who joins and leaves voice in the text channel, or `rolling` to keep editing a single message. `off` to not announce anything.",
+		set: func(_ *commandContext, link *voiceLink, value string) error {
+			switch strings.ToLower(value) {
+			case "", "off":
+				link.Announce = ""
+			case announcePost, announceRolling:
+				link.Announce = strings.ToLower(value)
+			default:
+				return userError("Please use `post`, `rolling` or `off`.")
+			}
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			return link.Announce
+		},
+	})
+
+	registerLinkOption(&linkOption{
+		name:        "jointemplate",
+		description: "The announcement when members join, {user} is replaced by their names and {voice} by the voice channel.",
+		set: func(_ *commandContext, link *voiceLink, value string) error {
+			if value != "" && !strings.Contains(value, "{user}") {
+				return userError("The template needs to contain `{user}`, for example: `{user} hopped into {voice}`")
+			}
+			link.JoinTemplate = value
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			return link.JoinTemplate
+		},
+	})
+
+	registerLinkOption(&linkOption{
+		name:        "leavetemplate",
+		description: "The announcement when members leave, {user} is replaced by their names and {voice} by the voice channel.",
+		set: func(_ *commandContext, link *voiceLink, value string) error {
+			if value != "" && !strings.Contains(value, "{user}") {
+				return userError("The template needs to contain `{user}`, for example: `{user} left {voice}`")
+			}
+			link.LeaveTemplate = value
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			return link.LeaveTemplate
+		},
+	})
+}
+
+// queueAnnouncement adds a join or leave of the voice channel to the next announcement, if its link announces them
+func queueAnnouncement(discord *discordgo.Session, guildID, voiceID, userID snowflake, joined bool) {
+	if userID == discord.State.User.ID {
+		return
+	}
+
+	configMutex.RLock()
+	link, exists := config.Guilds[guildID][voiceID]
+	announce := exists && link.Announce != ""
+	configMutex.RUnlock()
+	if !announce {
+		return
+	}
+
+	announceMutex.Lock()
+	defer announceMutex.Unlock()
+
+	batch, pending := announceBatches[voiceID]
+	if !pending {
+		batch = &announcementBatch{guildID: guildID, before: make(map[snowflake]bool), after: make(map[snowflake]bool)}
+		announceBatches[voiceID] = batch
+		scheduleOnce("announce:"+voiceID, announceBatchDelay, func() {
+			flushAnnouncements(discord, voiceID)
+		})
+	}
+
+	if _, seen := batch.after[userID]; !seen {
+		batch.order = append(batch.order, userID)
+		batch.before[userID] = !joined
+	}
+	batch.after[userID] = joined
+}
+
+// flushAnnouncements announces the joins and leaves collected for the voice channel. Members that left and came back
+// (or the other way around) within the batch are not announced.
+func flushAnnouncements(discord *discordgo.Session, voiceID snowflake) {
+	announceMutex.Lock()
+	batch := announceBatches[voiceID]
+	delete(announceBatches, voiceID)
+	announceMutex.Unlock()
+	if batch == nil {
+		return
+	}
+
+	var joined, left []string
+	for _, userID := range batch.order {
+		if batch.before[userID] == batch.after[userID] {
+			continue
+		}
+
+		name := getUserName(discord, batch.guildID, userID)
+		if member, err := getGuildMember(discord, batch.guildID, userID); err == nil {
+			name = member.DisplayName()
+		}
+		if batch.after[userID] {
+			joined = append(joined, name)
+		} else {
+			left = append(left, name)
+		}
+	}
+	if len(joined) == 0 && len(left) == 0 {
+		return
+	}
+
+	configMutex.RLock()
+	link, exists := config.Guilds[batch.guildID][voiceID]
+	if !exists || link.Announce == "" || link.TextChannelID == "" {
+		configMutex.RUnlock()
+		return
+	}
+	mode, textID := link.Announce, link.TextChannelID
+	joinTemplate, leaveTemplate := link.JoinTemplate, link.LeaveTemplate
+	configMutex.RUnlock()
+
+	if joinTemplate == "" {
+		joinTemplate = defaultJoinTemplate
+	}
+	if leaveTemplate == "" {
+		leaveTemplate = defaultLeaveTemplate
+	}
+	voiceName := voiceID
+	if voice, err := getChannel(discord, voiceID); err == nil {
+		voiceName = voice.Name
+	}
+
+	var lines []string
+	if len(joined) != 0 {
+		lines = append(lines, "📥 "+fillAnnouncement(joinTemplate, joined, voiceName))
+	}
+	if len(left) != 0 {
+		lines = append(lines, "📤 "+fillAnnouncement(leaveTemplate, left, voiceName))
+	}
+
+	if mode == announceRolling {
+		postRollingAnnouncement(discord, voiceID, textID, lines)
+		return
+	}
+
+	_, err := discord.ChannelMessageSendComplex(textID, &discordgo.MessageSend{
+		Content:         truncate(strings.Join(lines, "\n"), 2000),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Println("Could not post announcement.", err)
+	}
+}
+
+// postRollingAnnouncement adds the lines to the rolling message of the voice channel. If others have posted since, a
+// new rolling message is started, so the announcements stay near the bottom of the chat.
+func postRollingAnnouncement(discord *discordgo.Session, voiceID, textID snowflake, lines []string) {
+	// Copy the rolling message, so the voice state handler isn't kept waiting on our requests to Discord
+	announceMutex.Lock()
+	var rolling *rollingAnnouncement
+	if current := rollingMessages[voiceID]; current != nil {
+		rolling = &rollingAnnouncement{messageID: current.messageID, lines: append([]string(nil), current.lines...)}
+	}
+	announceMutex.Unlock()
+
+	if rolling != nil {
+		latest, err := discord.ChannelMessages(textID, 1, "", "", "")
+		if err != nil || len(latest) == 0 || latest[0].ID != rolling.messageID {
+			rolling = nil
+		}
+	}
+
+	if rolling != nil {
+		rolling.lines = append(rolling.lines, lines...)
+		if len(rolling.lines) > maxRollingLines {
+			rolling.lines = rolling.lines[len(rolling.lines)-maxRollingLines:]
+		}
+
+		content := truncate(strings.Join(rolling.lines, "\n"), 2000)
+		edit := discordgo.NewMessageEdit(textID, rolling.messageID).SetContent(content)
+		edit.AllowedMentions = &discordgo.MessageAllowedMentions{}
+		if _, err := discord.ChannelMessageEditComplex(edit); err == nil {
+			storeRollingAnnouncement(voiceID, rolling)
+			return
+		}
+		log.Println("Could not edit rolling announcement, posting a new one.")
+	}
+
+	message, err := discord.ChannelMessageSendComplex(textID, &discordgo.MessageSend{
+		Content:         truncate(strings.Join(lines, "\n"), 2000),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Println("Could not post announcement.", err)
+		storeRollingAnnouncement(voiceID, nil)
+		return
+	}
+
+	storeRollingAnnouncement(voiceID, &rollingAnnouncement{messageID: message.ID, lines: lines})
+}
+
+// storeRollingAnnouncement remembers the rolling message of the voice channel, or forgets it if nil
+func storeRollingAnnouncement(voiceID snowflake, rolling *rollingAnnouncement) {
+	announceMutex.Lock()
+	defer announceMutex.Unlock()
+
+	if rolling == nil {
+		delete(rollingMessages, voiceID)
+		return
+	}
+	rollingMessages[voiceID] = rolling
+}
+
+// fillAnnouncement fills in the template for the given names, e.g. "Alice, Bob and Carol joined General"
+func fillAnnouncement(template string, names []string, voiceName string) string {
+	users := names[len(names)-1]
+	if len(names) > 1 {
+		users = strings.Join(names[:len(names)-1], ", ") + " and " + users
+	}
+
+	return strings.NewReplacer("{user}", users, "{voice}", voiceName).Replace(template)
+}
@@ -15,20 +15,27 @@ type snowflake = string
 var discord *discordgo.Session
 
 func init() {
-	if os.Getenv("TOKEN") == "" {
-		log.Fatal("Please provide a Discord bot token through the \"TOKEN\" environment variable.")
-	}
-
-	log.Println("Initializing bot...")
-	// Initialize the bot session
+	// Initialize the bot session, it only connects once main opens it. The token is checked there as well, so the
+	// package can be tested without one.
 	var err error
 	discord, err = discordgo.New("Bot " + os.Getenv("TOKEN"))
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	// The text commands need to be able to read message contents, and the access requirements need to see role and
+	// timeout changes, both are privileged intents
+	discord.Identify.Intents = discordgo.IntentsAllWithoutPrivileged | discordgo.IntentsMessageContent | discordgo.IntentsGuildMembers
 }
 
 func main() {
+	if os.Getenv("TOKEN") == "" {
+		log.Fatal("Please provide a Discord bot token through the \"TOKEN\" environment variable.")
+	}
+
+	log.Println("Initializing bot...")
+	loadConfig()
+
 	defer log.Println("Successfully disconnected.")
 
 	// Open the websocket connection
@@ -37,6 +44,9 @@ func main() {
 	}
 	defer discord.Close()
 
+	// Remove blocks and guest passes as they expire
+	go sweepExpired()
+
 	log.Println("Bot has successfully connected to Discord, now accepting events...")
 	log.Println("Use Ctrl+C to shut the bot down.")
 	defer log.Println("Shutting down bot...")
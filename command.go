@@ -1,210 +1,326 @@
 package main
 
 import (
-	"fmt"
 	"log"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-func init() {
-	discord.AddHandler(onCommandEvent)
+const defaultCommandPrefix = "!"
+
+// argumentType describes what kind of value a command argument accepts
+type argumentType int
+
+const (
+	argumentString argumentType = iota
+	argumentVoiceChannel
+	argumentTextChannel
+	argumentCategory
+	argumentRole
+	argumentUser
+	argumentMentionable // Either a role or a user
+	argumentFlag        // Given as --name in text commands, always optional
+)
+
+// argument describes a single argument of a command, used for parsing, usage messages and slash command options
+type argument struct {
+	name        string
+	description string
+	typ         argumentType
+	optional    bool
+	choices     []string // If set, the value has to be one of these
+	rest        bool     // If set, the value is the rest of the message, only for the last argument
+	// match checks whether a value looks like it belongs to this argument, optional. If the last value of a text
+	// command matches, the optional argument before this one is left out.
+	match func(value string) bool
 }
 
-func onCommandEvent(discord *discordgo.Session, event *discordgo.MessageCreate) {
-	if !strings.HasPrefix(event.Content, "!") {
-		return
+// command describes a single command the bot knows, both as text command and as slash command
+type command struct {
+	name       string
+	aliases    []string
+	arguments  []argument
+	permission permissionLevel
+	help       string
+	handler    func(ctx *commandContext)
+}
+
+// commandContext contains everything a command handler needs to know about the invocation, regardless of whether it
+// was invoked through a text message or through a slash command.
+type commandContext struct {
+	discord     *discordgo.Session
+	guildID     snowflake
+	channelID   snowflake // The channel the command was invoked in
+	user        *discordgo.User
+	member      *discordgo.Member
+	permissions int64  // The server-wide permissions of the user
+	prefix      string // The prefix to use when referring to other commands
+	command     *command
+	args        map[string]string
+	channels    map[string]*discordgo.Channel
+	roles       map[string]*discordgo.Role
+	members     map[string]*discordgo.Member
+	send        func(message *discordgo.MessageSend)
+}
+
+// respond sends a plain text response to the user that invoked the command
+func (ctx *commandContext) respond(content string) {
+	ctx.send(&discordgo.MessageSend{Content: content})
+}
+
+// respondLines sends the lines as plain text responses, spread over as many messages as needed to stay within the
+// 2000 character limit Discord has on messages
+func (ctx *commandContext) respondLines(lines []string) {
+	var message string
+	for _, line := range lines {
+		line = truncate(line, 2000)
+		if message != "" && utf8.RuneCountInString(message)+1+utf8.RuneCountInString(line) > 2000 {
+			ctx.respond(strings.TrimSpace(message))
+			message = ""
+		}
+		if message != "" {
+			message += "\n"
+		}
+		message += line
 	}
 
-	// Check if the user has the MANAGE_CHANNELS permission
-	serverPerms, _ := getPermissionsFromMessage(discord, event)
-	if serverPerms&discordgo.PermissionManageChannels != discordgo.PermissionManageChannels {
-		// Ignore
-		return
+	if strings.TrimSpace(message) != "" {
+		ctx.respond(strings.TrimSpace(message))
 	}
+}
 
-	args := strings.Split(event.Content, " ")
+// arg returns the value of the given argument, or an empty string if it was not provided
+func (ctx *commandContext) arg(name string) string {
+	return ctx.args[name]
+}
 
-	switch strings.ToLower(args[0]) {
-	case "!voicelink":
-		linkCommand(discord, event, args[1:])
-	case "!voiceunlink":
-		unlinkCommand(discord, event, args[1:])
-	case "!voicelinklist":
-		list(discord, event)
-	}
+// flag returns whether the given flag argument was set
+func (ctx *commandContext) flag(name string) bool {
+	return ctx.args[name] == "true"
+}
 
-	// Silently fail if there's an unknown command
+// channel returns the resolved channel for the given channel argument, or nil if it was not provided
+func (ctx *commandContext) channel(name string) *discordgo.Channel {
+	return ctx.channels[name]
 }
 
-func linkCommand(discord *discordgo.Session, event *discordgo.MessageCreate, args []string) {
-	// Check if the command was invoked correctly
-	if len(args) != 2 {
-		discord.ChannelMessageSend(event.ChannelID, event.Author.Mention()+" Usage of this command:\n"+
-			"```\n"+
-			"!voicelink <voiceChannelID> <textChannelID|textChannelMention>\n"+
-			"```")
-		return
-	}
+// role returns the resolved role for the given role or mentionable argument, or nil if it was not provided
+func (ctx *commandContext) role(name string) *discordgo.Role {
+	return ctx.roles[name]
+}
 
-	// Get the voice channel instance
-	voice, err := getChannel(discord, args[0])
-	if err != nil {
-		discord.ChannelMessageSend(event.ChannelID, event.Author.Mention()+" I'm sorry, I could not find that voice channel.")
-		return
-	}
+// guildMember returns the resolved member for the given user or mentionable argument, or nil if it was not provided
+func (ctx *commandContext) guildMember(name string) *discordgo.Member {
+	return ctx.members[name]
+}
 
-	// Get the text channel instance
-	text, err := getChannel(discord, strings.Trim(args[1], "<#>"))
-	if err != nil {
-		discord.ChannelMessageSend(event.ChannelID, event.Author.Mention()+" I'm sorry, I could not find that text channel.")
-		return
+var (
+	commands        []*command
+	commandsByAlias = make(map[string]*command)
+)
+
+// registerCommand adds a command to the registry, making it available as text command and slash command.
+func registerCommand(cmd *command) {
+	commands = append(commands, cmd)
+	for _, name := range append([]string{cmd.name}, cmd.aliases...) {
+		if _, exists := commandsByAlias[name]; exists {
+			log.Fatalf("Command %s is registered twice.\n", name)
+		}
+		commandsByAlias[name] = cmd
 	}
+}
+
+func init() {
+	discord.AddHandler(onCommandEvent)
+
+	registerCommand(&command{
+		name:    "voicehelp",
+		aliases: []string{"voicecommands"},
+		arguments: []argument{
+			{name: "command", description: "The command to show help for.", typ: argumentString, optional: true},
+		},
+		help:    "Shows all commands you can use, or detailed help for a single command.",
+		handler: helpCommand,
+	})
+}
 
-	// Ensure they're of the same type
-	if voice.Type != discordgo.ChannelTypeGuildVoice || text.Type != discordgo.ChannelTypeGuildText {
-		discord.ChannelMessageSend(event.ChannelID, event.Author.Mention()+" The first argument needs to be a voice channel, "+
-			"the second argument needs to be a text channel.")
+func onCommandEvent(discord *discordgo.Session, event *discordgo.MessageCreate) {
+	// Ignore other bots (and ourselves), as well as direct messages
+	if event.Author == nil || event.Author.Bot || event.GuildID == "" {
 		return
 	}
 
-	// Get the channel the command was invoked in
-	channel, err := getChannel(discord, event.ChannelID)
-	if err != nil {
-		log.Println("Could not fetch channel from despite us being able to earlier")
+	content, isCommand := stripCommandPrefix(discord, event.GuildID, event.Content)
+	if !isCommand {
 		return
 	}
 
-	// Make sure it was invoked in the correct guild
-	if channel.GuildID != voice.GuildID || channel.GuildID != text.GuildID {
-		discord.ChannelMessageSend(event.ChannelID, event.Author.Mention()+" The channels provided both need"+
-			"to be in the same server as where you execute the command.")
+	args := tokenize(content)
+	if len(args) == 0 {
 		return
 	}
+	name := strings.ToLower(args[0])
+	prefix := getCommandPrefix(event.GuildID)
+
+	send := func(message *discordgo.MessageSend) {
+		message.Content = strings.TrimSpace(event.Author.Mention() + " " + message.Content)
+		// Only ping the user that invoked the command, never any roles or users mentioned in the response
+		message.AllowedMentions = &discordgo.MessageAllowedMentions{Users: []string{event.Author.ID}}
+		if _, err := discord.ChannelMessageSendComplex(event.ChannelID, message); err != nil {
+			log.Println("Could not send command response.", err)
+		}
+	}
 
-	log.Printf("User %s has invoked command: %s\n", event.Author.String(), event.Content)
-
-	// Add it to the list
-	configMutex.Lock()
-	list, exists := config.Guilds[channel.GuildID]
+	cmd, exists := commandsByAlias[name]
 	if !exists {
-		list = make(guildChannels)
-		config.Guilds[channel.GuildID] = list
+		// Other bots might share our prefix, so we only respond to commands that look like ours
+		if strings.HasPrefix(name, "voice") {
+			send(&discordgo.MessageSend{Content: "I don't know that command, use `" + prefix + "voicehelp` to see the commands I do know."})
+		}
+		return
 	}
-	list[voice.ID] = text.ID
-	configMutex.Unlock()
-	go saveConfig()
 
-	// Send a confirmation
-	discord.ChannelMessageSend(event.ChannelID, event.Author.Mention()+" Success! I've linked the voice channel "+
-		voice.Name+" to the text channel "+text.Mention()+".")
-
-	// And trigger a guild update
-	guild, err := getGuild(discord, channel.GuildID)
+	member, err := getGuildMember(discord, event.GuildID, event.Author.ID)
 	if err != nil {
-		log.Println("Couldn't fetch guild.", err)
+		log.Println("Could not fetch guild member", err)
 		return
 	}
-	go onGuildUpdate(discord, &discordgo.GuildCreate{Guild: guild})
-}
 
-func unlinkCommand(discord *discordgo.Session, event *discordgo.MessageCreate, args []string) {
-	// Check if the command was invoked correctly
-	if len(args) != 1 {
-		discord.ChannelMessageSend(event.ChannelID, event.Author.Mention()+" Usage of this command:\n"+
-			"```\n"+
-			"!voiceunlink <voiceChannelID>\n"+
-			"```")
-		return
+	serverPerms, _ := getPermissionsFromMessage(discord, event)
+	ctx := &commandContext{
+		discord:     discord,
+		guildID:     event.GuildID,
+		channelID:   event.ChannelID,
+		user:        event.Author,
+		member:      member,
+		permissions: serverPerms,
+		prefix:      prefix,
+		command:     cmd,
+		send:        send,
 	}
 
-	// Get the channel the command was invoked in
-	channel, err := getChannel(discord, event.ChannelID)
+	values, err := mapArguments(cmd, args[1:])
+	if err == nil {
+		err = ctx.setArguments(values)
+	}
+	if err == nil {
+		err = ctx.checkPermission()
+	}
 	if err != nil {
-		log.Println("Could not fetch channel from despite us being able to earlier")
+		ctx.respondError(err)
 		return
 	}
 
-	configMutex.Lock()
-	defer configMutex.Unlock()
+	log.Printf("User %s has invoked command: %s\n", event.Author.String(), event.Content)
+	cmd.handler(ctx)
+}
 
-	// Check if this guild even has any registered channels
-	channels, guildKnown := config.Guilds[channel.GuildID]
-	if !guildKnown {
-		discord.ChannelMessageSend(event.ChannelID, event.Author.Mention()+" I know no registered channels for this server.")
-		return
-	}
+// getCommandPrefix returns the text command prefix configured for the given guild
+func getCommandPrefix(guildID snowflake) string {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
 
-	// Check if the requested channel is registered
-	_, channelRegistered := channels[args[0]]
-	if !channelRegistered {
-		discord.ChannelMessageSend(event.ChannelID, event.Author.Mention()+" That is not a registered voice channel in this server.")
-		return
+	if settings, exists := config.Settings[guildID]; exists && settings.Prefix != "" {
+		return settings.Prefix
 	}
 
-	log.Printf("User %s has invoked command: %s\n", event.Author.String(), event.Content)
+	return defaultCommandPrefix
+}
 
-	// Remove it from the list
-	delete(channels, args[0])
-	if len(channels) == 0 {
-		delete(config.Guilds, channel.GuildID)
+// stripCommandPrefix checks whether the message is a command, which is the case if it starts with the prefix of the
+// guild or with a mention of the bot. The latter always works, so a misconfigured prefix can still be fixed.
+// It returns the message content without the prefix.
+func stripCommandPrefix(discord *discordgo.Session, guildID snowflake, content string) (string, bool) {
+	botID := discord.State.User.ID
+	for _, mention := range []string{"<@" + botID + ">", "<@!" + botID + ">"} {
+		if strings.HasPrefix(content, mention) {
+			content = strings.TrimSpace(strings.TrimPrefix(content, mention))
+			// Allow both "@bot voicehelp" and "@bot !voicehelp"
+			return strings.TrimPrefix(content, getCommandPrefix(guildID)), content != ""
+		}
 	}
-	go saveConfig()
-
-	// Send a confirmation
-	discord.ChannelMessageSend(event.ChannelID, event.Author.Mention()+" Success! I've unlinked that voice channel!")
 
-	// And trigger a guild update
-	guild, err := getGuild(discord, channel.GuildID)
-	if err != nil {
-		log.Println("Couldn't fetch guild.", err)
-		return
+	prefix := getCommandPrefix(guildID)
+	if !strings.HasPrefix(content, prefix) {
+		return "", false
 	}
 
-	go onGuildUpdate(discord, &discordgo.GuildCreate{Guild: guild})
+	return strings.TrimPrefix(content, prefix), true
 }
 
-func list(discord *discordgo.Session, event *discordgo.MessageCreate) {
-	// Get the channel the command was invoked in
-	channel, err := getChannel(discord, event.ChannelID)
-	if err != nil {
-		log.Println("Could not fetch channel from despite us being able to earlier")
+// respondError informs the user about an error in their command invocation
+func (ctx *commandContext) respondError(err error) {
+	if err == errUsage {
+		ctx.respond("Usage of this command:\n```\n" + usage(ctx.prefix, ctx.command) + "\n```")
 		return
 	}
 
-	configMutex.RLock()
-	defer configMutex.RUnlock()
+	ctx.respond(err.Error())
+}
 
-	channels, guildKnown := config.Guilds[channel.GuildID]
-	if !guildKnown {
-		discord.ChannelMessageSend(event.ChannelID, event.Author.Mention()+" I know no registered channels for this server.")
-		return
+// usage generates the usage line for a command from its argument schema
+func usage(prefix string, cmd *command) string {
+	line := prefix + cmd.name
+	for _, arg := range cmd.arguments {
+		if arg.typ == argumentFlag {
+			line += " [--" + arg.name + "]"
+		} else if arg.optional {
+			line += " [" + arg.name + "]"
+		} else {
+			line += " <" + arg.name + ">"
+		}
 	}
 
-	log.Printf("User %s has invoked command: %s\n", event.Author.String(), event.Content)
+	return line
+}
+
+// sortedCommands returns the registered commands, sorted by name
+func sortedCommands() []*command {
+	sorted := make([]*command, len(commands))
+	copy(sorted, commands)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].name < sorted[j].name
+	})
+
+	return sorted
+}
 
-	description := event.Author.Mention() + "These are the voice channels I have currently linked to text channels:\n"
-	found := false
-	for voiceID, textID := range channels {
-		voice, err := getChannel(discord, voiceID)
-		if err != nil {
-			continue // Ignore, invalid link
+func helpCommand(ctx *commandContext) {
+	// Detailed help for a single command
+	if name := strings.TrimPrefix(strings.ToLower(ctx.arg("command")), ctx.prefix); name != "" {
+		cmd, exists := commandsByAlias[strings.TrimPrefix(name, "/")]
+		if !exists {
+			ctx.respond("I don't know that command, use `" + ctx.prefix + "voicehelp` to see the commands I do know.")
+			return
 		}
 
-		text, err := getChannel(discord, textID)
-		if err != nil {
-			continue // Ignore, invalid link
+		help := "```\n" + usage(ctx.prefix, cmd) + "\n```" + cmd.help
+		for _, arg := range cmd.arguments {
+			help += "\n• `" + arg.name + "`: " + arg.description
+		}
+		if len(cmd.aliases) != 0 {
+			help += "\nAliases: `" + ctx.prefix + strings.Join(cmd.aliases, "`, `"+ctx.prefix) + "`"
+		}
+		if cmd.permission != permissionEveryone {
+			help += "\nRequires " + cmd.permission.description() + "."
 		}
 
-		found = true
-		description += fmt.Sprintf("\nThe voice channel \"%s\" (%s) is linked to %s (%s).", voice.Name, voice.ID, text.Mention(), text.ID)
+		ctx.respond(help)
+		return
 	}
 
-	if !found {
-		discord.ChannelMessageSend(event.ChannelID, event.Author.Mention()+" I know no registered channels for this server.")
-		return
+	// The overview of all commands doesn't fit in a single message
+	lines := []string{"These are the commands I know:", ""}
+	for _, cmd := range sortedCommands() {
+		if !ctx.mayUse(cmd) {
+			continue
+		}
+		lines = append(lines, "`"+usage(ctx.prefix, cmd)+"`\n"+cmd.help)
 	}
+	lines = append(lines, "", "Use `"+ctx.prefix+"voicehelp <command>` for more information about a command.")
 
-	discord.ChannelMessageSend(event.ChannelID, description)
+	ctx.respondLines(lines)
 }
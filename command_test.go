@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestRespondLines(t *testing.T) {
+	var sent []string
+	ctx := &commandContext{send: func(message *discordgo.MessageSend) {
+		sent = append(sent, message.Content)
+	}}
+
+	lines := []string{"These are the commands I know:", ""}
+	for i := 0; i < 30; i++ {
+		lines = append(lines, "`!command`\n"+strings.Repeat("é", 100))
+	}
+	lines = append(lines, strings.Repeat("x", 2500))
+	ctx.respondLines(lines)
+
+	if len(sent) < 2 {
+		t.Fatalf("respondLines sent %d messages, want the lines split over several", len(sent))
+	}
+	total := 0
+	for _, message := range sent {
+		if length := utf8.RuneCountInString(message); length == 0 || length > 2000 {
+			t.Errorf("respondLines sent a message of %d characters", length)
+		}
+		total += strings.Count(message, "`!command`")
+	}
+	if total != 30 {
+		t.Errorf("respondLines sent %d of the 30 commands", total)
+	}
+}
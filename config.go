@@ -5,28 +5,204 @@ import (
 	"log"
 	"os"
 	"sync"
+	"time"
 )
 
 const configFileName = "config.json"
 
-// guildLinks is a map used for one specific guild, the key is the voice channel, the value is the linked text channel
-type guildChannels = map[snowflake]snowflake
+// guildChannels is a map used for one specific guild, the key is the voice channel, the value is its link
+type guildChannels = map[snowflake]*voiceLink
+
+// voiceLink contains the linked text channel of a voice channel, along with the settings of that link
+type voiceLink struct {
+	// TextChannelID is the text channel members of the voice channel get access to.
+	// For ephemeral links, this is empty while the voice channel is not in use.
+	TextChannelID snowflake `json:"textChannel"`
+	// Ephemeral is "delete" or "archive" if the text channel only exists while the voice channel is in use, and
+	// what happens to it once the voice channel is empty again. Empty for a permanent text channel.
+	Ephemeral string `json:"ephemeral,omitempty"`
+	// GracePeriod is how long an ephemeral text channel is kept after the voice channel empties, zero for the default
+	GracePeriod time.Duration `json:"gracePeriod,omitempty"`
+	// ArchiveCategoryID is the category archived ephemeral text channels are moved to, empty to leave them in place
+	ArchiveCategoryID snowflake `json:"archiveCategory,omitempty"`
+	// ChannelName is the name given to new ephemeral text channels, empty to derive it from the voice channel name
+	ChannelName string `json:"channelName,omitempty"`
+	// Retention is "purge" or "archive" if the messages in the text channel are deleted once the voice channel is
+	// empty, and whether they're exported first. Empty to keep them.
+	Retention string `json:"retention,omitempty"`
+	// RetentionDelay is how long the voice channel has to be empty before the messages are deleted
+	RetentionDelay time.Duration `json:"retentionDelay,omitempty"`
+	// Transcript is the format transcripts of the text channel are written in after every session, empty for none
+	Transcript string `json:"transcript,omitempty"`
+	// TranscriptChannelID is the text channel transcripts are posted in, empty to only write them to a file
+	TranscriptChannelID snowflake `json:"transcriptChannel,omitempty"`
+	// Announce is "post" or "rolling" if joins and leaves are announced in the text channel, in new messages or by
+	// editing a single message. Empty to not announce them.
+	Announce string `json:"announce,omitempty"`
+	// JoinTemplate and LeaveTemplate are the announcements, empty for the defaults
+	JoinTemplate  string `json:"joinTemplate,omitempty"`
+	LeaveTemplate string `json:"leaveTemplate,omitempty"`
+	// StatusMessage keeps a pinned message in the text channel listing who is in voice
+	StatusMessage bool `json:"statusMessage,omitempty"`
+	// StatusMessageID and StatusChannelID identify the current status message, so we keep editing it after a restart
+	StatusMessageID snowflake `json:"statusMessageId,omitempty"`
+	StatusChannelID snowflake `json:"statusChannelId,omitempty"`
+	// Mirror relays messages between the text chat of the voice channel and the linked text channel
+	Mirror bool `json:"mirror,omitempty"`
+	// Ping is who may ping everyone in voice from the text channel: "everyone", "managers" or "off". Empty for the
+	// members in voice and managers.
+	Ping string `json:"ping,omitempty"`
+	// PingKeyword also pings everyone in voice when someone writes @voice in the text channel
+	PingKeyword bool `json:"pingKeyword,omitempty"`
+	// Policy maps voice conditions like "mute" or "selfdeaf" to the access members get while in them: "full", "read"
+	// or "none". Conditions that are not in it use their default.
+	Policy map[string]string `json:"policy,omitempty"`
+	// RequiredRoles contains the roles of which members need at least one to get access, empty to not require any
+	RequiredRoles []snowflake `json:"requiredRoles,omitempty"`
+	// BlockedRoles contains the roles whose members never get access
+	BlockedRoles []snowflake `json:"blockedRoles,omitempty"`
+	// MinAccountAge and MinMemberAge are how old the account of members and their membership of the guild need to be
+	// to get access, zero for no minimum
+	MinAccountAge time.Duration `json:"minAccountAge,omitempty"`
+	MinMemberAge  time.Duration `json:"minMemberAge,omitempty"`
+	// RequireScreening only gives access to members that completed the membership screening
+	RequireScreening bool `json:"requireScreening,omitempty"`
+	// BlockTimeout only gives access to members that are not timed out
+	BlockTimeout bool `json:"blockTimeout,omitempty"`
+	// Blocks contains the members that never get access to the text channel, even while in voice
+	Blocks []*linkBlock `json:"blocks,omitempty"`
+	// Guests contains the members that have access to the text channel for a while, without being in voice
+	Guests []*linkGuest `json:"guests,omitempty"`
+	// SpectatorRoles contains the roles that can always see the text channel, through a role overwrite
+	SpectatorRoles []snowflake `json:"spectatorRoles,omitempty"`
+	// ExemptRoles and ExemptUsers contain the members whose access to the text channel we leave alone, besides the
+	// ones exempt in the whole guild
+	ExemptRoles []snowflake `json:"exemptRoles,omitempty"`
+	ExemptUsers []snowflake `json:"exemptUsers,omitempty"`
+	// ExemptBots leaves the access of all bots to the text channel alone
+	ExemptBots bool `json:"exemptBots,omitempty"`
+	// SessionStart is when the current session in the voice channel started, nil if nobody is in it
+	SessionStart *time.Time `json:"sessionStart,omitempty"`
+	// LinkedBy is the user that created the link, if known
+	LinkedBy snowflake `json:"linkedBy,omitempty"`
+	// LinkedAt is when the link was created, if known
+	LinkedAt *time.Time `json:"linkedAt,omitempty"`
+	// History contains the most recent changes made to this link
+	History []*linkChange `json:"history,omitempty"`
+}
+
+// linkBlock keeps a member out of the text channel of a link, until it expires or is removed
+type linkBlock struct {
+	UserID snowflake `json:"user"`
+	By     snowflake `json:"by"`
+	At     time.Time `json:"at"`
+	// Until is when the block expires, nil if it lasts until the member is unblocked
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// linkGuest gives a member access to the text channel of a link until it expires, regardless of their voice state
+type linkGuest struct {
+	UserID snowflake `json:"user"`
+	By     snowflake `json:"by"`
+	At     time.Time `json:"at"`
+	Until  time.Time `json:"until"`
+}
+
+// maxLinkHistory is the amount of changes we remember per link
+const maxLinkHistory = 10
+
+// linkChange is a single change made to a link
+type linkChange struct {
+	At          time.Time `json:"at"`
+	By          snowflake `json:"by"`
+	Description string    `json:"description"`
+}
+
+// recordChange adds a change to the history of the link, forgetting the oldest changes if needed.
+// The caller is expected to hold a write lock on configMutex.
+func (link *voiceLink) recordChange(by snowflake, description string) {
+	link.History = append(link.History, &linkChange{At: time.Now(), By: by, Description: description})
+	if len(link.History) > maxLinkHistory {
+		link.History = link.History[len(link.History)-maxLinkHistory:]
+	}
+}
+
+// UnmarshalJSON allows reading config files from older versions, in which a link was just the text channel ID.
+func (link *voiceLink) UnmarshalJSON(data []byte) error {
+	var textChannelID snowflake
+	if err := json.Unmarshal(data, &textChannelID); err == nil {
+		*link = voiceLink{TextChannelID: textChannelID}
+		return nil
+	}
+
+	// Prevent recursion by using a type without this method
+	type plainLink voiceLink
+	return json.Unmarshal(data, (*plainLink)(link))
+}
 
 // channelList is the global registry of guilds that we have voice-text channel links for
 type channelList = map[snowflake]guildChannels
 
+// guildSettings contains the settings of a single guild, that are not specific to any link
+type guildSettings struct {
+	// Prefix is the prefix used for text commands in this guild, empty for the default prefix
+	Prefix string `json:"prefix,omitempty"`
+	// ManagerRoles contains the roles whose members may manage links without the Manage Channels permission
+	ManagerRoles []snowflake `json:"managerRoles,omitempty"`
+	// ManagerUsers contains the users that may manage links without the Manage Channels permission
+	ManagerUsers []snowflake `json:"managerUsers,omitempty"`
+	// RequireChannelPermission makes us check the Manage Channels permission on the channels a command is invoked with,
+	// rather than server-wide.
+	RequireChannelPermission bool `json:"requireChannelPermission,omitempty"`
+	// AutoLinkTemplate is the naming rule used by voicelinkauto to find the text channel for a voice channel
+	AutoLinkTemplate string `json:"autoLinkTemplate,omitempty"`
+	// ExemptRoles and ExemptUsers contain the members whose access to linked text channels we leave alone, as they
+	// can see them anyway, like moderators
+	ExemptRoles []snowflake `json:"exemptRoles,omitempty"`
+	ExemptUsers []snowflake `json:"exemptUsers,omitempty"`
+	// ExemptBots leaves the access of all bots to linked text channels alone
+	ExemptBots bool `json:"exemptBots,omitempty"`
+	// Hubs contains the "join to create" voice channels of this guild, the key is the hub voice channel ID
+	Hubs map[snowflake]*roomHub `json:"hubs,omitempty"`
+	// Rooms contains the temporary voice channels created through a hub, the key is the room voice channel ID
+	Rooms map[snowflake]*tempRoom `json:"rooms,omitempty"`
+}
+
+// roomHub contains the settings of a voice channel that creates a personal room for everyone joining it
+type roomHub struct {
+	// CategoryID is the category new rooms are created in, empty for the category of the hub itself
+	CategoryID snowflake `json:"category,omitempty"`
+}
+
+// tempRoom is a voice channel created through a hub, which is deleted once it is empty
+type tempRoom struct {
+	OwnerID   snowflake `json:"owner"`
+	HubID     snowflake `json:"hub"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
 var (
 	configMutex sync.RWMutex
-	config      = struct {
+	// saveMutex makes sure only one save writes the config file at a time
+	saveMutex sync.Mutex
+	config    = struct {
 		// Guilds contains all voice-text-channel links per guild.
-		// The key is the voice channel ID, the value is the text channel ID.
+		// The key is the voice channel ID, the value is its link, see voiceLink.
 		Guilds channelList `json:"guilds"`
+		// Settings contains the guild-wide settings per guild, the key is the guild ID.
+		Settings map[snowflake]*guildSettings `json:"settings"`
+		// SpectatorGrants contains the spectator roles we gave access to a text channel, per text channel per guild.
+		// Roles that could already see the text channel are not in here, their access is left alone.
+		SpectatorGrants map[snowflake]map[snowflake][]snowflake `json:"spectatorGrants,omitempty"`
 	}{
-		Guilds: make(channelList),
+		Guilds:          make(channelList),
+		Settings:        make(map[snowflake]*guildSettings),
+		SpectatorGrants: make(map[snowflake]map[snowflake][]snowflake),
 	}
 )
 
-func init() {
+// loadConfig reads the config file, or creates it if it doesn't exist yet
+func loadConfig() {
 	// If the config file doesn't exist, create it.
 	if _, err := os.Stat(configFileName); os.IsNotExist(err) {
 		if err = saveConfig(); err != nil {
@@ -47,20 +223,48 @@ func init() {
 	if err = json.NewDecoder(f).Decode(&config); err != nil {
 		log.Fatal(err)
 	}
+
+	// Config files from older versions do not have these yet
+	if config.Guilds == nil {
+		config.Guilds = make(channelList)
+	}
+	if config.Settings == nil {
+		config.Settings = make(map[snowflake]*guildSettings)
+	}
+	if config.SpectatorGrants == nil {
+		config.SpectatorGrants = make(map[snowflake]map[snowflake][]snowflake)
+	}
 }
 
+// getGuildSettings returns the settings of the given guild, creating them if they do not exist yet.
+// The caller is expected to hold a write lock on configMutex.
+func getGuildSettings(guildID snowflake) *guildSettings {
+	settings, exists := config.Settings[guildID]
+	if !exists {
+		settings = new(guildSettings)
+		config.Settings[guildID] = settings
+	}
+
+	return settings
+}
+
+// saveConfig writes the config to disk. It is often started in its own goroutine, so saves are serialised, and each
+// one is written to a temporary file first so a crash halfway never leaves a corrupt config behind.
 func saveConfig() error {
-	configMutex.RLock()
-	defer configMutex.RUnlock()
+	saveMutex.Lock()
+	defer saveMutex.Unlock()
 
-	f, err := os.OpenFile(configFileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	configMutex.RLock()
+	content, err := json.MarshalIndent(config, "", "    ")
+	configMutex.RUnlock()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	e := json.NewEncoder(f)
-	e.SetIndent("", "    ")
+	temporary := configFileName + ".tmp"
+	if err = os.WriteFile(temporary, append(content, '\n'), 0644); err != nil {
+		return err
+	}
 
-	return e.Encode(config)
+	return os.Rename(temporary, configFileName)
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// The permissions we give ourselves on channels we create, so we can manage the overwrites of members in voice
+const companionBotPermissions = discordgo.PermissionViewChannel | discordgo.PermissionSendMessages |
+	discordgo.PermissionManageRoles | discordgo.PermissionManageChannels | discordgo.PermissionReadMessageHistory |
+	discordgo.PermissionManageMessages | discordgo.PermissionManageWebhooks
+
+func init() {
+	registerCommand(&command{
+		name: "voicelinkcreate",
+		arguments: []argument{
+			{name: "voice", description: "The voice channel to create a text channel for.", typ: argumentVoiceChannel},
+			{name: "name", description: "The name of the new text channel, defaults to the voice channel name followed by -chat.", typ: argumentString, optional: true},
+			{name: "ephemeral", description: "Only create the text channel while someone is in voice, and delete it once everyone has left.", typ: argumentFlag},
+		},
+		permission: permissionManager,
+		help:       "Creates a text channel only visible to members in the voice channel, and links it to that voice channel.",
+		handler:    createCommand,
+	})
+}
+
+func createCommand(ctx *commandContext) {
+	voice := ctx.channel("voice")
+
+	configMutex.RLock()
+	_, linked := config.Guilds[ctx.guildID][voice.ID]
+	configMutex.RUnlock()
+	if linked {
+		ctx.respond("That voice channel is already linked, use `" + ctx.prefix + "voicelinkedit` to change its text channel.")
+		return
+	}
+
+	// Ephemeral text channels are created once someone joins the voice channel
+	if ctx.flag("ephemeral") {
+		configMutex.Lock()
+		link := addLink(ctx.guildID, voice.ID, "", ctx.user.ID)
+		link.Ephemeral = ephemeralDelete
+		link.ChannelName = ctx.arg("name")
+		configMutex.Unlock()
+		go saveConfig()
+
+		log.Printf("User %s has created an ephemeral link for voice channel %s.\n", ctx.user.String(), voice.Name)
+		ctx.respond("Success! I'll create a text channel for " + voice.Name + " whenever someone is in it, and delete it " +
+			formatDuration(defaultGracePeriod) + " after everyone has left. Use `" + ctx.prefix + "voicelinkset` to change this.")
+
+		triggerGuildUpdate(ctx.discord, ctx.guildID)
+		return
+	}
+
+	name := ctx.arg("name")
+	if name == "" {
+		name = channelSlug(voice.Name) + "-chat"
+	}
+
+	text, err := createCompanionChannel(ctx.discord, voice, name)
+	if err != nil {
+		log.Println("Could not create text channel.", err)
+		ctx.respond("I'm sorry, I could not create the text channel. Make sure I have the Manage Channels and Manage Roles permissions.")
+		return
+	}
+
+	configMutex.Lock()
+	addLink(ctx.guildID, voice.ID, text.ID, ctx.user.ID)
+	configMutex.Unlock()
+	go saveConfig()
+
+	log.Printf("User %s has created text channel #%s for voice channel %s.\n", ctx.user.String(), text.Name, voice.Name)
+	ctx.respond("Success! I've created " + text.Mention() + " and linked it to the voice channel " + voice.Name + ".")
+
+	triggerGuildUpdate(ctx.discord, ctx.guildID)
+}
+
+// createCompanionChannel creates a text channel in the same category as the voice channel, which is hidden for
+// everyone, but manageable by us. It keeps the overwrites of the category, so moderators keep their access.
+func createCompanionChannel(discord *discordgo.Session, voice *discordgo.Channel, name string) (*discordgo.Channel, error) {
+	overwrites := append(categoryOverwrites(discord, voice.GuildID, voice.ParentID),
+		&discordgo.PermissionOverwrite{
+			ID:   voice.GuildID, // @everyone
+			Type: discordgo.PermissionOverwriteTypeRole,
+			Deny: discordgo.PermissionViewChannel,
+		},
+		&discordgo.PermissionOverwrite{
+			ID:    discord.State.User.ID,
+			Type:  discordgo.PermissionOverwriteTypeMember,
+			Allow: companionBotPermissions,
+		},
+	)
+
+	text, err := discord.GuildChannelCreateComplex(voice.GuildID, discordgo.GuildChannelCreateData{
+		Name:                 name,
+		Type:                 discordgo.ChannelTypeGuildText,
+		Topic:                "Text chat for the voice channel " + voice.Name + ", only visible to those in voice.",
+		ParentID:             voice.ParentID,
+		PermissionOverwrites: overwrites,
+	})
+	if err != nil {
+		return nil, err
+	}
+	discord.State.ChannelAdd(text)
+
+	return text, nil
+}
+
+// categoryOverwrites copies the overwrites of the category, for a new channel that should keep its permissions.
+// The overwrites of @everyone and of ourselves are left out, as the new channel sets its own.
+func categoryOverwrites(discord *discordgo.Session, guildID, categoryID snowflake) []*discordgo.PermissionOverwrite {
+	if categoryID == "" {
+		return nil
+	}
+
+	category, err := getChannel(discord, categoryID)
+	if err != nil {
+		return nil
+	}
+
+	var overwrites []*discordgo.PermissionOverwrite
+	for _, overwrite := range category.PermissionOverwrites {
+		if overwrite.ID == guildID || overwrite.ID == discord.State.User.ID {
+			continue
+		}
+		copied := *overwrite
+		overwrites = append(overwrites, &copied)
+	}
+
+	return overwrites
+}
@@ -10,7 +10,8 @@ func init() {
 	discord.AddHandler(onAFK)
 }
 
-// onAFK is responsible for moving users that deafen themselves to the Guilds AFK channel
+// onAFK is responsible for moving users that deafen themselves to the Guilds AFK channel, unless the policy of the
+// link of their voice channel says what access deafened members get
 func onAFK(discord *discordgo.Session, voiceState *discordgo.VoiceStateUpdate) {
 	// This event handler should only return if the user is deafened
 	if !voiceState.Deaf && !voiceState.SelfDeaf {
@@ -34,9 +35,18 @@ func onAFK(discord *discordgo.Session, voiceState *discordgo.VoiceStateUpdate) {
 		return
 	}
 
+	// Links can have a policy for deafened members, they stay in voice then
+	configMutex.RLock()
+	link, linked := config.Guilds[voiceState.GuildID][voiceState.ChannelID]
+	allowed := linked && link.allowsDeafened(voiceState.VoiceState)
+	configMutex.RUnlock()
+	if allowed {
+		return
+	}
+
 	// Move the user
 	log.Printf("Moving user %s to the guild AFK channel because they are deafened.\n", getUserName(discord, voiceState.GuildID, voiceState.UserID))
-	if err = discord.GuildMemberMove(voiceState.GuildID, voiceState.UserID, guild.AfkChannelID); err != nil {
+	if err = discord.GuildMemberMove(voiceState.GuildID, voiceState.UserID, &guild.AfkChannelID); err != nil {
 		log.Println("Could not move member to AFK channel", err)
 	}
 }
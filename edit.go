@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log"
+)
+
+func init() {
+	registerCommand(&command{
+		name: "voicelinkedit",
+		arguments: []argument{
+			{name: "voice", description: "The linked voice channel.", typ: argumentVoiceChannel},
+			{name: "text", description: "The text channel to link it to instead.", typ: argumentTextChannel},
+		},
+		permission: permissionManager,
+		help:       "Changes the text channel a voice channel is linked to, moving everyone's access along without interruption.",
+		handler:    editCommand,
+	})
+}
+
+func editCommand(ctx *commandContext) {
+	voice, text := ctx.channel("voice"), ctx.channel("text")
+
+	guild, err := getGuild(ctx.discord, ctx.guildID)
+	if err != nil {
+		ctx.respond("I'm sorry, I could not look up the voice states of this server.")
+		return
+	}
+
+	configMutex.Lock()
+	links := config.Guilds[ctx.guildID]
+	link, exists := links[voice.ID]
+	if !exists {
+		configMutex.Unlock()
+		ctx.respond("That is not a registered voice channel in this server.")
+		return
+	}
+
+	if link.Ephemeral != "" {
+		configMutex.Unlock()
+		ctx.respond("That voice channel has an ephemeral text channel, use `" + ctx.prefix + "voicelinkset \"" + voice.Name + "\" ephemeral off` first.")
+		return
+	}
+
+	oldTextID := link.TextChannelID
+	if oldTextID == text.ID {
+		configMutex.Unlock()
+		ctx.respond("That voice channel is already linked to " + text.Mention() + ".")
+		return
+	}
+
+	link.TextChannelID = text.ID
+	link.recordChange(ctx.user.ID, "Text channel changed from <#"+oldTextID+"> to <#"+text.ID+">")
+	configMutex.Unlock()
+	go saveConfig()
+
+	// Plan the move under a read lock, the requests to Discord are made without holding any lock
+	configMutex.RLock()
+	links = config.Guilds[ctx.guildID]
+	filtered, _ := linksSharingText(links, voice.ID)
+	plans := planOverwrites(ctx.discord, filtered, guild.VoiceStates, "")
+
+	// Only remove the access to the old text channel after giving everyone access to the new one, unless another
+	// voice channel is still linked to it
+	var remaining []snowflake
+	for voiceID, other := range links {
+		if other.TextChannelID == oldTextID {
+			remaining = append(remaining, voiceID)
+		}
+	}
+	if plan, err := planText(ctx.discord, oldTextID, remaining, guild.VoiceStates, ""); err == nil {
+		plans = append(plans, plan)
+	}
+	configMutex.RUnlock()
+
+	for _, plan := range plans {
+		applyPlan(ctx.discord, ctx.guildID, plan)
+	}
+
+	// The spectator roles move along as well
+	syncSpectators(ctx.discord, ctx.guildID)
+
+	log.Printf("User %s has moved the link of voice channel %s from text channel %s to #%s.\n", ctx.user.String(), voice.Name, oldTextID, text.Name)
+	ctx.respond("Success! The voice channel " + voice.Name + " is now linked to " + text.Mention() + " instead of <#" + oldTextID + ">.")
+}
+
+// lastChange returns the most recent change of a link, or nil if it was never changed
+func lastChange(link *voiceLink) *linkChange {
+	if len(link.History) == 0 {
+		return nil
+	}
+
+	return link.History[len(link.History)-1]
+}
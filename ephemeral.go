@@ -0,0 +1,340 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// defaultGracePeriod is how long we keep an ephemeral text channel after its voice channel empties, unless configured
+const defaultGracePeriod = 5 * time.Minute
+
+const (
+	ephemeralDelete  = "delete"
+	ephemeralArchive = "archive"
+)
+
+var (
+	creatingMutex sync.Mutex
+	// creating contains the voice channels whose ephemeral text channel is being created right now
+	creating = make(map[snowflake]bool)
+)
+
+func init() {
+	registerLinkOption(&linkOption{
+		name:        "ephemeral",
+		description: "`delete` or `archive` to only have a text channel while someone is in voice, which is deleted or archived once everyone has left. `off` for a permanent text channel.",
+		set:         setEphemeralOption,
+		show: func(link *voiceLink) string {
+			return link.Ephemeral
+		},
+		changed: refreshGuild,
+	})
+
+	registerLinkOption(&linkOption{
+		name:        "grace",
+		description: "How long an ephemeral text channel is kept after everyone has left, like `10m` or `1h`.",
+		set: func(_ *commandContext, link *voiceLink, value string) error {
+			grace, err := parseOptionalDuration(value)
+			if err != nil {
+				return err
+			}
+			link.GracePeriod = grace
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			if link.GracePeriod == 0 {
+				return ""
+			}
+			return formatDuration(link.GracePeriod)
+		},
+	})
+
+	registerLinkOption(&linkOption{
+		name:        "archivecategory",
+		description: "The category archived ephemeral text channels are moved to.",
+		set: func(ctx *commandContext, link *voiceLink, value string) error {
+			if value == "" {
+				link.ArchiveCategoryID = ""
+				return nil
+			}
+
+			category, err := parseChannel(ctx, value, discordgo.ChannelTypeGuildCategory)
+			if err != nil {
+				return err
+			}
+			link.ArchiveCategoryID = category.ID
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			if link.ArchiveCategoryID == "" {
+				return ""
+			}
+			return "<#" + link.ArchiveCategoryID + ">"
+		},
+	})
+}
+
+// setEphemeralOption switches a link between a permanent and an ephemeral text channel
+func setEphemeralOption(ctx *commandContext, link *voiceLink, value string) error {
+	voice := ctx.channel("voice")
+
+	switch strings.ToLower(value) {
+	case "", "off":
+		if link.Ephemeral == "" {
+			return nil
+		}
+
+		// A permanent link always needs a text channel, so create one if nobody is in voice right now
+		cancelRemoval(voice.ID)
+		if link.TextChannelID == "" {
+			text, err := createCompanionChannel(ctx.discord, voice, link.channelName(voice))
+			if err != nil {
+				log.Println("Could not create text channel.", err)
+				return userError("I'm sorry, I could not create a text channel. Make sure I have the Manage Channels and Manage Roles permissions.")
+			}
+			link.TextChannelID = text.ID
+		}
+		link.Ephemeral = ""
+	case "on", ephemeralDelete:
+		link.Ephemeral = ephemeralDelete
+	case ephemeralArchive:
+		link.Ephemeral = ephemeralArchive
+	default:
+		return userError("Please use `delete`, `archive` or `off`.")
+	}
+
+	// Keep the name of the current text channel for the ones we'll create later
+	if link.Ephemeral != "" && link.ChannelName == "" && link.TextChannelID != "" {
+		if text, err := getChannel(ctx.discord, link.TextChannelID); err == nil {
+			link.ChannelName = text.Name
+		}
+	}
+
+	return nil
+}
+
+// gracePeriod returns how long the ephemeral text channel of the link is kept after the voice channel empties
+func (link *voiceLink) gracePeriod() time.Duration {
+	if link.GracePeriod == 0 {
+		return defaultGracePeriod
+	}
+
+	return link.GracePeriod
+}
+
+// channelName returns the name for a new ephemeral text channel of the link
+func (link *voiceLink) channelName(voice *discordgo.Channel) string {
+	if link.ChannelName != "" {
+		return link.ChannelName
+	}
+
+	return channelSlug(voice.Name) + "-chat"
+}
+
+// syncEphemeralChannels creates the text channels of ephemeral links whose voice channel is in use, and schedules the
+// removal of those whose voice channel is empty. If no voice channels are given, all links of the guild are checked.
+// As the text channel IDs are stored in the config, this also picks up channels left behind by a restart.
+// The caller should not hold a lock on configMutex.
+func syncEphemeralChannels(discord *discordgo.Session, guildID snowflake, voiceIDs []snowflake) {
+	guild, err := getGuild(discord, guildID)
+	if err != nil {
+		log.Println("Couldn't fetch guild.", err)
+		return
+	}
+
+	occupied := make(map[snowflake]bool)
+	for _, state := range guild.VoiceStates {
+		occupied[state.ChannelID] = true
+	}
+
+	configMutex.RLock()
+	links := config.Guilds[guildID]
+	if voiceIDs == nil {
+		for voiceID := range links {
+			voiceIDs = append(voiceIDs, voiceID)
+		}
+	}
+
+	var missing []snowflake
+	for _, voiceID := range voiceIDs {
+		link, exists := links[voiceID]
+		if !exists || link.Ephemeral == "" {
+			continue
+		}
+
+		if !occupied[voiceID] {
+			if link.TextChannelID != "" {
+				scheduleRemoval(discord, guildID, voiceID, link.gracePeriod())
+			}
+			continue
+		}
+
+		cancelRemoval(voiceID)
+		if link.TextChannelID == "" {
+			missing = append(missing, voiceID)
+		}
+	}
+	configMutex.RUnlock()
+
+	for _, voiceID := range missing {
+		createEphemeralChannel(discord, guildID, voiceID)
+	}
+}
+
+// createEphemeralChannel creates the text channel of the ephemeral link of the voice channel, unless it is already
+// being created. The caller should not hold a lock on configMutex.
+func createEphemeralChannel(discord *discordgo.Session, guildID, voiceID snowflake) {
+	// Two members joining at once should not get a channel each
+	creatingMutex.Lock()
+	if creating[voiceID] {
+		creatingMutex.Unlock()
+		return
+	}
+	creating[voiceID] = true
+	creatingMutex.Unlock()
+
+	defer func() {
+		creatingMutex.Lock()
+		delete(creating, voiceID)
+		creatingMutex.Unlock()
+	}()
+
+	voice, err := getChannel(discord, voiceID)
+	if err != nil {
+		log.Println("Channel exists in config, but not in state.")
+		return
+	}
+
+	configMutex.RLock()
+	link, exists := config.Guilds[guildID][voiceID]
+	needed := exists && link.Ephemeral != "" && link.TextChannelID == ""
+	var name string
+	if needed {
+		name = link.channelName(voice)
+	}
+	configMutex.RUnlock()
+	if !needed {
+		return // Created in the meantime
+	}
+
+	text, err := createCompanionChannel(discord, voice, name)
+	if err != nil {
+		log.Println("Could not create ephemeral text channel.", err)
+		return
+	}
+
+	configMutex.Lock()
+	link, exists = config.Guilds[guildID][voiceID]
+	stored := exists && link.Ephemeral != "" && link.TextChannelID == ""
+	if stored {
+		link.TextChannelID = text.ID
+	}
+	configMutex.Unlock()
+
+	if !stored {
+		// The link was changed or removed while the channel was being created
+		if _, err = discord.ChannelDelete(text.ID); err != nil {
+			log.Println("Could not delete ephemeral text channel.", err)
+		}
+		return
+	}
+
+	log.Printf("Created ephemeral text channel #%s for voice channel %s.\n", text.Name, voice.Name)
+	go saveConfig()
+
+	// Give everyone in voice access, including those that joined while the channel was being created
+	triggerGuildUpdate(discord, guildID)
+}
+
+// scheduleRemoval removes the ephemeral text channel of the voice channel after the grace period, unless a removal
+// is already pending.
+func scheduleRemoval(discord *discordgo.Session, guildID, voiceID snowflake, grace time.Duration) {
+	scheduleOnce("ephemeral:"+voiceID, grace, func() {
+		removeEphemeralChannel(discord, guildID, voiceID)
+	})
+}
+
+// cancelRemoval stops the pending removal of the ephemeral text channel of the voice channel, if any
+func cancelRemoval(voiceID snowflake) {
+	cancelScheduled("ephemeral:" + voiceID)
+}
+
+// removeEphemeralChannel unlinks the ephemeral text channel of the voice channel and deletes or archives it, as long
+// as the voice channel is still empty.
+func removeEphemeralChannel(discord *discordgo.Session, guildID, voiceID snowflake) {
+	guild, err := getGuild(discord, guildID)
+	if err != nil {
+		log.Println("Couldn't fetch guild.", err)
+		return
+	}
+
+	configMutex.Lock()
+	link, exists := config.Guilds[guildID][voiceID]
+	if !exists || link.Ephemeral == "" || link.TextChannelID == "" {
+		configMutex.Unlock()
+		return
+	}
+	for _, state := range guild.VoiceStates {
+		if state.ChannelID == voiceID {
+			configMutex.Unlock()
+			return
+		}
+	}
+
+	// Forget about the channel first, so its deletion is not mistaken for the removal of a linked channel
+	textID, mode, archiveID := link.TextChannelID, link.Ephemeral, link.ArchiveCategoryID
+	link.TextChannelID = ""
+	configMutex.Unlock()
+	go saveConfig()
+
+	disposeEphemeralChannel(discord, textID, mode, archiveID)
+}
+
+// disposeEphemeralChannel deletes or archives a text channel that is no longer linked. Archiving removes everyone's
+// access, including that of spectator roles, and renames the channel, optionally moving it to the given category.
+// The caller should not hold a lock on configMutex.
+func disposeEphemeralChannel(discord *discordgo.Session, textID snowflake, mode string, archiveID snowflake) {
+	text, err := getChannel(discord, textID)
+	if err != nil {
+		log.Println("Could not find ephemeral text channel.", err)
+		return
+	}
+
+	if mode != ephemeralArchive {
+		log.Printf("Deleting ephemeral text channel #%s.\n", text.Name)
+		if _, err = discord.ChannelDelete(textID); err != nil {
+			log.Println("Could not delete ephemeral text channel.", err)
+		}
+		return
+	}
+
+	log.Printf("Archiving ephemeral text channel #%s.\n", text.Name)
+	if plan, err := planText(discord, textID, nil, nil, ""); err == nil {
+		applyPlan(discord, text.GuildID, plan)
+	}
+	// The channel is no longer linked, so this takes the access of the spectator roles away as well
+	syncSpectators(discord, text.GuildID)
+
+	_, err = discord.ChannelEdit(textID, &discordgo.ChannelEdit{
+		Name:     truncate("archived-"+text.Name, 100),
+		ParentID: archiveID,
+	})
+	if err != nil {
+		log.Println("Could not archive ephemeral text channel.", err)
+	}
+}
+
+// releaseEphemeralChannel disposes of the current ephemeral text channel of a link that is being removed or replaced,
+// so it is not left behind. The caller is expected to hold a write lock on configMutex.
+func releaseEphemeralChannel(discord *discordgo.Session, voiceID snowflake, link *voiceLink) {
+	if link == nil || link.Ephemeral == "" || link.TextChannelID == "" {
+		return
+	}
+
+	cancelRemoval(voiceID)
+	go disposeEphemeralChannel(discord, link.TextChannelID, link.Ephemeral, link.ArchiveCategoryID)
+}
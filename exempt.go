@@ -0,0 +1,162 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// exemption describes the members whose overwrites we leave alone on a text channel, because they can see it anyway
+type exemption struct {
+	roles []snowflake
+	users []snowflake
+	bots  bool
+}
+
+func init() {
+	registerCommand(&command{
+		name: "voiceexempt",
+		arguments: []argument{
+			{name: "action", description: "Whether to add, remove or list exempt roles and users.", typ: argumentString, choices: []string{"add", "remove", "list"}},
+			{name: "target", description: "The role or user to add or remove.", typ: argumentMentionable, optional: true},
+		},
+		permission: permissionAdmin,
+		help:       "Manages the roles and users I never give or take access to linked text channels, in all links.",
+		handler:    exemptCommand,
+	})
+
+	registerCommand(&command{
+		name: "voiceexemptbots",
+		arguments: []argument{
+			{name: "mode", description: "\"on\" to leave the access of all bots alone, \"off\" to treat them like everyone else.", typ: argumentString, choices: []string{"on", "off"}, optional: true},
+		},
+		permission: permissionAdmin,
+		help:       "Shows or changes whether bots are exempt from being given access to linked text channels, in all links.",
+		handler:    exemptBotsCommand,
+	})
+
+	registerLinkOption(&linkOption{
+		name:        "exempt",
+		description: "Roles and users I never give or take access to this text channel, separated by spaces. Use mentions or IDs.",
+		set: func(ctx *commandContext, link *voiceLink, value string) error {
+			var roles, users []snowflake
+			for _, target := range strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' }) {
+				if role, err := resolveRole(ctx.discord, ctx.guildID, target); err == nil {
+					roles = append(roles, role.ID)
+					continue
+				}
+				member, err := resolveMember(ctx.discord, ctx.guildID, target)
+				if err != nil {
+					return userError("I'm sorry, I could not find a role or member matching \"" + target + "\".")
+				}
+				users = append(users, member.User.ID)
+			}
+
+			link.ExemptRoles, link.ExemptUsers = roles, users
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			var targets []string
+			for _, roleID := range link.ExemptRoles {
+				targets = append(targets, "<@&"+roleID+">")
+			}
+			for _, userID := range link.ExemptUsers {
+				targets = append(targets, "<@"+userID+">")
+			}
+			return strings.Join(targets, " ")
+		},
+		changed: refreshGuild,
+	})
+
+	exemptBots := switchOption("exemptbots", "`on` to leave the access of all bots to this text channel alone.", func(link *voiceLink) *bool { return &link.ExemptBots })
+	exemptBots.changed = refreshGuild
+	registerLinkOption(exemptBots)
+}
+
+func exemptCommand(ctx *commandContext) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	settings := getGuildSettings(ctx.guildID)
+	var extra []string
+	if settings.ExemptBots {
+		extra = append(extra, "all bots")
+	}
+
+	changed := editTargets(ctx, &settings.ExemptRoles, &settings.ExemptUsers, extra, targetMessages{
+		what:    "exemptions",
+		empty:   "Nobody is exempt in this server, I manage the access of everyone in voice.",
+		list:    "I leave the access of these roles and users alone: ",
+		exists:  " is already exempt.",
+		added:   " is now exempt, I will no longer give or take their access to linked text channels.",
+		missing: " is not exempt.",
+		removed: " is no longer exempt.",
+	})
+	if changed {
+		triggerGuildUpdate(ctx.discord, ctx.guildID)
+	}
+}
+
+func exemptBotsCommand(ctx *commandContext) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	settings := getGuildSettings(ctx.guildID)
+	changed := switchMode(ctx, &settings.ExemptBots, "on", modeMessages{
+		what: "bot exemption",
+		on:   "Bots are exempt, I leave their access to linked text channels alone.",
+		off:  "Bots are not exempt, they get access to linked text channels like everyone else.",
+	})
+	if changed {
+		triggerGuildUpdate(ctx.discord, ctx.guildID)
+	}
+}
+
+// exemptionFor combines the guild-wide exemptions with those of the given links. Links sharing a text channel share
+// its overwrites, so a member exempt in any of them is exempt on the text channel.
+// The caller is expected to hold a read lock on configMutex.
+func exemptionFor(guildID snowflake, voiceIDs []snowflake) *exemption {
+	exempt := new(exemption)
+	if settings, exists := config.Settings[guildID]; exists {
+		exempt.roles = append(exempt.roles, settings.ExemptRoles...)
+		exempt.users = append(exempt.users, settings.ExemptUsers...)
+		exempt.bots = settings.ExemptBots
+	}
+
+	for _, voiceID := range voiceIDs {
+		link, exists := config.Guilds[guildID][voiceID]
+		if !exists {
+			continue
+		}
+		exempt.roles = append(exempt.roles, link.ExemptRoles...)
+		exempt.users = append(exempt.users, link.ExemptUsers...)
+		exempt.bots = exempt.bots || link.ExemptBots
+	}
+
+	return exempt
+}
+
+// covers checks whether the member is exempt. Members we can't look up are not exempt, unless exempt by ID.
+func (exempt *exemption) covers(discord *discordgo.Session, guildID, userID snowflake) bool {
+	if containsSnowflake(exempt.users, userID) {
+		return true
+	}
+	if len(exempt.roles) == 0 && !exempt.bots {
+		return false
+	}
+
+	member, err := getGuildMember(discord, guildID, userID)
+	if err != nil {
+		return false
+	}
+	if exempt.bots && member.User.Bot {
+		return true
+	}
+	for _, roleID := range member.Roles {
+		if containsSnowflake(exempt.roles, roleID) {
+			return true
+		}
+	}
+
+	return false
+}
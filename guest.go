@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerCommand(&command{
+		name: "voicelinkguest",
+		arguments: []argument{
+			{name: "user", description: "The member that may read along.", typ: argumentUser},
+			{name: "voice", description: "The linked voice channel.", typ: argumentVoiceChannel},
+			{name: "duration", description: "How long the guest pass lasts, like 30m or 2h, or \"end\" to end it early.", typ: argumentString},
+		},
+		permission: permissionManager,
+		help:       "Gives a member access to a linked text channel for a while, without being in voice.",
+		handler:    guestCommand,
+	})
+}
+
+func guestCommand(ctx *commandContext) {
+	member, voice := ctx.guildMember("user"), ctx.channel("voice")
+
+	var until time.Time
+	if value := ctx.arg("duration"); !strings.EqualFold(value, "end") {
+		duration, err := parseDuration(value)
+		if err != nil {
+			ctx.respondError(err)
+			return
+		}
+		until = time.Now().Add(duration)
+	}
+
+	configMutex.Lock()
+	link, exists := config.Guilds[ctx.guildID][voice.ID]
+	if !exists {
+		configMutex.Unlock()
+		ctx.respond("That is not a registered voice channel in this server.")
+		return
+	}
+
+	if until.IsZero() {
+		if link.findGuest(member.User.ID) == nil {
+			configMutex.Unlock()
+			ctx.respond(member.User.String() + " has no guest pass for the link of " + voice.Name + ".")
+			return
+		}
+		link.Guests = removeGuest(link.Guests, member.User.ID)
+		link.recordChange(ctx.user.ID, "Guest pass of <@"+member.User.ID+"> ended")
+	} else {
+		if link.findBlock(member.User.ID) != nil {
+			configMutex.Unlock()
+			ctx.respond(member.User.String() + " is blocked from the link of " + voice.Name + ", use `" + ctx.prefix + "voicelinkunblock` first.")
+			return
+		}
+		link.Guests = removeGuest(link.Guests, member.User.ID)
+		link.Guests = append(link.Guests, &linkGuest{UserID: member.User.ID, By: ctx.user.ID, At: time.Now(), Until: until})
+		link.recordChange(ctx.user.ID, fmt.Sprintf("Guest pass given to <@%s> until <t:%d:f>", member.User.ID, until.Unix()))
+	}
+	configMutex.Unlock()
+	go saveConfig()
+
+	// Give or take the access right away
+	reevaluateMember(ctx.discord, ctx.guildID, member.User.ID)
+
+	if until.IsZero() {
+		log.Printf("User %s has ended the guest pass of %s for the link of voice channel %s.\n", ctx.user.String(), member.User.String(), voice.Name)
+		ctx.respond("Success! The guest pass of " + member.User.String() + " for the link of " + voice.Name + " has ended.")
+		return
+	}
+
+	log.Printf("User %s has given %s a guest pass for the link of voice channel %s until %s.\n", ctx.user.String(), member.User.String(), voice.Name, until.Format(time.RFC3339))
+	ctx.respond(fmt.Sprintf("Success! %s can read along in the text channel of %s until <t:%d:f>.", member.User.String(), voice.Name, until.Unix()))
+}
+
+// findGuest returns the guest pass of the user on this link, or nil if they don't have one (anymore)
+func (link *voiceLink) findGuest(userID snowflake) *linkGuest {
+	for _, guest := range link.Guests {
+		if guest.UserID == userID && !guest.expired() {
+			return guest
+		}
+	}
+
+	return nil
+}
+
+// expired checks whether the guest pass has run out
+func (guest *linkGuest) expired() bool {
+	return !guest.Until.After(time.Now())
+}
+
+// removeGuest returns the guest passes without the ones of the given user
+func removeGuest(guests []*linkGuest, userID snowflake) []*linkGuest {
+	var filtered []*linkGuest
+	for _, guest := range guests {
+		if guest.UserID != userID {
+			filtered = append(filtered, guest)
+		}
+	}
+
+	return filtered
+}
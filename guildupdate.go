@@ -15,48 +15,23 @@ func init() {
 // onGuildUpdate is responsible for ensuring the current permission state is up to date with all voice states.
 // It is called during bot startup & after executing linking commands
 func onGuildUpdate(discord *discordgo.Session, newGuild *discordgo.GuildCreate) {
-	configMutex.RLock()
-	defer configMutex.RUnlock()
+	// Bring the ephemeral text channels up to date first, this also cleans up the ones left behind by a restart
+	syncEphemeralChannels(discord, newGuild.ID, nil)
+	trackSessions(discord, newGuild.ID, nil)
+	scheduleStatusUpdates(discord, newGuild.ID)
 
 	// Check if this guild is a registered guild
-	guild, exists := config.Guilds[newGuild.ID]
-	if !exists {
-		return
-	}
-
-	seen := make(map[string]bool)
-
-	// First, add existing voice states.
-	for _, state := range newGuild.VoiceStates {
-		seen[state.UserID] = true
-		go onVoiceStateUpdate(discord, &discordgo.VoiceStateUpdate{VoiceState: state})
-	}
-
-	// Second, remove existing overwrites that are no longer valid
-	for _, textChannelID := range guild {
-		textChannel, err := getChannel(discord, textChannelID)
-		if err != nil {
-			log.Println("Channel exists in config, but not in state.")
-			continue
-		}
-
-		for _, overwrite := range textChannel.PermissionOverwrites {
-			if overwrite.Type != "member" {
-				continue
-			}
-
-			_, isInVoice := seen[overwrite.ID]
-			if isInVoice {
-				continue
-			}
-
-			// We have an overwrite for this user on a registered channel, they're not in the seen map, so remove them.
-			go onVoiceStateUpdate(discord, &discordgo.VoiceStateUpdate{VoiceState: &discordgo.VoiceState{
-				GuildID: newGuild.ID,
-				UserID:  overwrite.ID,
-			}})
+	configMutex.RLock()
+	if guild, exists := config.Guilds[newGuild.ID]; exists {
+		// Add missing overwrites for members in voice, and remove the ones of members that are no longer in voice
+		for _, plan := range planOverwrites(discord, guild, newGuild.VoiceStates, "") {
+			applyPlan(discord, newGuild.ID, plan)
 		}
 	}
+	configMutex.RUnlock()
+
+	// Spectator roles can see the text channels regardless of who is in voice, also after the last link is removed
+	syncSpectators(discord, newGuild.ID)
 }
 
 // onGuildRemove is responsible for maintaining our config state if the bot is removed from a guild
@@ -65,11 +40,14 @@ func onGuildRemove(_ *discordgo.Session, event *discordgo.GuildDelete) {
 	defer configMutex.Unlock()
 
 	_, guildKnown := config.Guilds[event.ID]
-	if !guildKnown {
+	_, hasSettings := config.Settings[event.ID]
+	if !guildKnown && !hasSettings {
 		return
 	}
 
 	delete(config.Guilds, event.ID)
+	delete(config.Settings, event.ID)
+	delete(config.SpectatorGrants, event.ID)
 	go saveConfig()
 }
 
@@ -88,8 +66,17 @@ func onChannelRemove(discord *discordgo.Session, event *discordgo.ChannelDelete)
 	updated := false
 
 	// If the channel ID matches any of the ones we know, remove the link
-	for voice, text := range channels {
-		if event.ID == voice || event.ID == text {
+	for voice, link := range channels {
+		switch {
+		case event.ID == voice:
+			releaseEphemeralChannel(discord, voice, link)
+			delete(channels, voice)
+			updated = true
+		case event.ID == link.TextChannelID && link.Ephemeral != "":
+			// Ephemeral links stay, a new text channel is created when needed
+			link.TextChannelID = ""
+			updated = true
+		case event.ID == link.TextChannelID:
 			delete(channels, voice)
 			updated = true
 		}
@@ -113,3 +100,15 @@ func onChannelRemove(discord *discordgo.Session, event *discordgo.ChannelDelete)
 		go onGuildUpdate(discord, &discordgo.GuildCreate{Guild: guild})
 	}
 }
+
+// triggerGuildUpdate will asynchronously run the guild update logic for the given guild, so that all overwrites
+// are brought up to date with the current links.
+func triggerGuildUpdate(discord *discordgo.Session, guildID snowflake) {
+	guild, err := getGuild(discord, guildID)
+	if err != nil {
+		log.Println("Couldn't fetch guild.", err)
+		return
+	}
+
+	go onGuildUpdate(discord, &discordgo.GuildCreate{Guild: guild})
+}
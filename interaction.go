@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// componentHandler handles an interaction with a message component (such as a button) that we have sent.
+// The args are the parts of the custom ID of the component after its name, separated by colons.
+type componentHandler func(discord *discordgo.Session, event *discordgo.InteractionCreate, args []string)
+
+var (
+	// The commands make no sense outside of a guild
+	commandContexts = []discordgo.InteractionContextType{discordgo.InteractionContextGuild}
+
+	componentHandlers = make(map[string]componentHandler)
+)
+
+// registerComponent registers the handler for all components whose custom ID starts with the given name
+func registerComponent(name string, handler componentHandler) {
+	componentHandlers[name] = handler
+}
+
+func init() {
+	discord.AddHandler(onReady)
+	discord.AddHandler(onInteractionCreate)
+}
+
+// applicationCommands generates the slash command definitions from the command registry.
+func applicationCommands() []*discordgo.ApplicationCommand {
+	var appCommands []*discordgo.ApplicationCommand
+	for _, cmd := range sortedCommands() {
+		appCommand := &discordgo.ApplicationCommand{
+			Name:        cmd.name,
+			Description: truncate(cmd.help, 100),
+			Contexts:    &commandContexts,
+		}
+
+		// Only members with the required permission get to see and use the command by default
+		appCommand.DefaultMemberPermissions = cmd.permission.defaultMemberPermissions()
+
+		for _, arg := range cmd.arguments {
+			option := &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        arg.name,
+				Description: truncate(arg.description, 100),
+				Required:    !arg.optional,
+			}
+
+			for _, choice := range arg.choices {
+				option.Choices = append(option.Choices, &discordgo.ApplicationCommandOptionChoice{Name: choice, Value: choice})
+			}
+
+			switch arg.typ {
+			case argumentVoiceChannel:
+				option.Type = discordgo.ApplicationCommandOptionChannel
+				option.ChannelTypes = []discordgo.ChannelType{discordgo.ChannelTypeGuildVoice}
+			case argumentTextChannel:
+				option.Type = discordgo.ApplicationCommandOptionChannel
+				option.ChannelTypes = []discordgo.ChannelType{discordgo.ChannelTypeGuildText}
+			case argumentCategory:
+				option.Type = discordgo.ApplicationCommandOptionChannel
+				option.ChannelTypes = []discordgo.ChannelType{discordgo.ChannelTypeGuildCategory}
+			case argumentRole:
+				option.Type = discordgo.ApplicationCommandOptionRole
+			case argumentUser:
+				option.Type = discordgo.ApplicationCommandOptionUser
+			case argumentMentionable:
+				option.Type = discordgo.ApplicationCommandOptionMentionable
+			case argumentFlag:
+				option.Type = discordgo.ApplicationCommandOptionBoolean
+				option.Required = false
+			}
+
+			appCommand.Options = append(appCommand.Options, option)
+		}
+
+		appCommands = append(appCommands, appCommand)
+	}
+
+	return appCommands
+}
+
+// onReady is responsible for registering our application commands with Discord.
+// If the "COMMAND_GUILD" environment variable is set, they're registered for that guild only, which makes them
+// available instantly and is useful during development. Otherwise they're registered globally.
+func onReady(discord *discordgo.Session, event *discordgo.Ready) {
+	appCommands := applicationCommands()
+
+	guildID := os.Getenv("COMMAND_GUILD")
+	if _, err := discord.ApplicationCommandBulkOverwrite(event.User.ID, guildID, appCommands); err != nil {
+		log.Println("Could not register application commands.", err)
+		return
+	}
+
+	log.Printf("Registered %d application commands.\n", len(appCommands))
+}
+
+// onInteractionCreate is responsible for handling slash commands and message component interactions.
+func onInteractionCreate(discord *discordgo.Session, event *discordgo.InteractionCreate) {
+	if event.GuildID == "" || event.Member == nil {
+		return
+	}
+
+	switch event.Type {
+	case discordgo.InteractionApplicationCommand:
+		onApplicationCommand(discord, event)
+	case discordgo.InteractionMessageComponent:
+		args := strings.Split(event.MessageComponentData().CustomID, ":")
+		if handler, exists := componentHandlers[args[0]]; exists {
+			handler(discord, event, args[1:])
+		}
+	}
+}
+
+// onApplicationCommand is responsible for handling the slash command variants of our text commands.
+func onApplicationCommand(discord *discordgo.Session, event *discordgo.InteractionCreate) {
+	data := event.ApplicationCommandData()
+	cmd, exists := commandsByAlias[data.Name]
+	if !exists {
+		return
+	}
+
+	// Acknowledge the interaction right away, some commands take longer than the interaction deadline
+	err := discord.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		log.Println("Could not respond to interaction.", err)
+		return
+	}
+
+	// The permissions Discord gives us include the overwrites of the channel the command was used in
+	permissions := event.Member.Permissions
+	if guild, err := getGuild(discord, event.GuildID); err == nil {
+		if serverPerms, err := computeBasePermissions(discord, event.Member, guild); err == nil {
+			permissions = serverPerms
+		}
+	}
+
+	ctx := &commandContext{
+		discord:     discord,
+		guildID:     event.GuildID,
+		channelID:   event.ChannelID,
+		user:        event.Member.User,
+		member:      event.Member,
+		permissions: permissions,
+		prefix:      "/",
+		command:     cmd,
+		send: func(message *discordgo.MessageSend) {
+			_, err := discord.FollowupMessageCreate(event.Interaction, true, &discordgo.WebhookParams{
+				Content:         message.Content,
+				Embeds:          message.Embeds,
+				Components:      message.Components,
+				Files:           message.Files,
+				AllowedMentions: &discordgo.MessageAllowedMentions{},
+				Flags:           discordgo.MessageFlagsEphemeral,
+			})
+			if err != nil {
+				log.Println("Could not send interaction response.", err)
+			}
+		},
+	}
+
+	values := make(map[string]string)
+	for _, option := range data.Options {
+		values[option.Name] = fmt.Sprint(option.Value)
+	}
+
+	// Discord already enforces the default member permissions, but server admins can override those.
+	err = ctx.setArguments(values)
+	if err == nil {
+		err = ctx.checkPermission()
+	}
+	if err != nil {
+		ctx.respondError(err)
+		return
+	}
+
+	log.Printf("User %s has invoked slash command: /%s\n", ctx.user.String(), cmd.name)
+	cmd.handler(ctx)
+}
+
+// respondEphemeral replies to an interaction with a message only visible to the user that invoked it.
+func respondEphemeral(discord *discordgo.Session, interaction *discordgo.Interaction, content string) {
+	err := discord.InteractionRespond(interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Println("Could not respond to interaction.", err)
+	}
+}
+
+// updateComponentMessage replaces the message a component belongs to, in response to an interaction with it.
+func updateComponentMessage(discord *discordgo.Session, interaction *discordgo.Interaction, message *discordgo.MessageSend) {
+	err := discord.InteractionRespond(interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    message.Content,
+			Embeds:     message.Embeds,
+			Components: message.Components,
+		},
+	})
+	if err != nil {
+		log.Println("Could not update component message.", err)
+	}
+}
+
+// truncate shortens a string to the given amount of characters, Discord enforces maximum lengths on most fields
+func truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+
+	return string(runes[:length-1]) + "…"
+}
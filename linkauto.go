@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const proposalTimeout = 5 * time.Minute
+
+// defaultAutoLinkTemplates are the naming rules tried when the guild has not configured its own
+var defaultAutoLinkTemplates = []string{"{name}", "{name}-chat", "{name}-text"}
+
+// autoLinkPair is a single link proposed by voicelinkauto
+type autoLinkPair struct {
+	voice *discordgo.Channel
+	text  *discordgo.Channel
+}
+
+// autoLinkProposal contains the links proposed by voicelinkauto, waiting for confirmation
+type autoLinkProposal struct {
+	guildID snowflake
+	userID  snowflake
+	pairs   []autoLinkPair
+}
+
+var (
+	proposalMutex sync.Mutex
+	proposals     = make(map[string]*autoLinkProposal)
+)
+
+func init() {
+	registerCommand(&command{
+		name: "voicelinkauto",
+		arguments: []argument{
+			{name: "mode", description: "Pair channels by \"name\" or by \"category\", defaults to name.", typ: argumentString, choices: []string{"name", "category"}, optional: true},
+			{name: "template", description: "The text channel name to look for, {name} is replaced by the voice channel name.", typ: argumentString, optional: true},
+			{name: "remember", description: "Remember the template as default for this server.", typ: argumentFlag},
+		},
+		permission: permissionManager,
+		help:       "Proposes links between unlinked voice and text channels based on their names or categories, and applies them after confirmation.",
+		handler:    autoLinkCommand,
+	})
+
+	registerComponent("voicelinkauto", onAutoLinkButton)
+}
+
+func autoLinkCommand(ctx *commandContext) {
+	guild, err := getGuild(ctx.discord, ctx.guildID)
+	if err != nil {
+		ctx.respond("I'm sorry, I could not look up the channels of this server.")
+		return
+	}
+
+	template := ctx.arg("template")
+	if template != "" && !strings.Contains(template, "{name}") {
+		ctx.respond("The template needs to contain `{name}`, which is replaced by the name of the voice channel. For example: `{name}-chat`")
+		return
+	}
+
+	configMutex.Lock()
+	settings := getGuildSettings(ctx.guildID)
+	if template != "" && ctx.flag("remember") {
+		settings.AutoLinkTemplate = template
+		go saveConfig()
+	}
+	templates := defaultAutoLinkTemplates
+	if template != "" {
+		templates = []string{template}
+	} else if settings.AutoLinkTemplate != "" {
+		templates = []string{settings.AutoLinkTemplate}
+	}
+	pairs := proposeLinks(guild, config.Guilds[ctx.guildID], ctx.arg("mode") == "category", templates)
+	configMutex.Unlock()
+
+	if len(pairs) == 0 {
+		ctx.respond("I could not find any unlinked voice channels with a matching text channel.")
+		return
+	}
+
+	id := strconv.FormatInt(time.Now().UnixNano(), 36)
+	proposalMutex.Lock()
+	proposals[id] = &autoLinkProposal{guildID: ctx.guildID, userID: ctx.user.ID, pairs: pairs}
+	proposalMutex.Unlock()
+
+	// Forget about the proposal if it is not confirmed in time
+	time.AfterFunc(proposalTimeout, func() {
+		proposalMutex.Lock()
+		delete(proposals, id)
+		proposalMutex.Unlock()
+	})
+
+	var lines []string
+	for _, pair := range pairs {
+		lines = append(lines, "🔊 "+pair.voice.Name+" → "+pair.text.Mention())
+	}
+
+	ctx.send(&discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{{
+			Title:       fmt.Sprintf("Proposed links (%d)", len(pairs)),
+			Description: truncate(strings.Join(lines, "\n"), 4096),
+			Color:       colorLinkList,
+			Footer:      &discordgo.MessageEmbedFooter{Text: "This proposal expires in 5 minutes."},
+		}},
+		Components: []discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "Apply", Style: discordgo.SuccessButton, CustomID: "voicelinkauto:apply:" + id},
+			discordgo.Button{Label: "Cancel", Style: discordgo.SecondaryButton, CustomID: "voicelinkauto:cancel:" + id},
+		}}},
+	})
+}
+
+// onAutoLinkButton handles the confirmation buttons of voicelinkauto, the args are the action and the proposal ID.
+func onAutoLinkButton(discord *discordgo.Session, event *discordgo.InteractionCreate, args []string) {
+	if len(args) != 2 {
+		return
+	}
+
+	proposalMutex.Lock()
+	proposal, exists := proposals[args[1]]
+	if !exists {
+		proposalMutex.Unlock()
+		updateComponentMessage(discord, event.Interaction, &discordgo.MessageSend{
+			Content:    "This proposal has expired, please use the command again.",
+			Embeds:     []*discordgo.MessageEmbed{},
+			Components: []discordgo.MessageComponent{},
+		})
+		return
+	}
+	if !isComponentOwner(discord, event, proposal.userID) {
+		proposalMutex.Unlock()
+		return
+	}
+	delete(proposals, args[1])
+	proposalMutex.Unlock()
+
+	if args[0] != "apply" {
+		updateComponentMessage(discord, event.Interaction, &discordgo.MessageSend{
+			Content:    "Cancelled, no links have been made.",
+			Embeds:     []*discordgo.MessageEmbed{},
+			Components: []discordgo.MessageComponent{},
+		})
+		return
+	}
+
+	// Voice channels linked since the proposal was shown keep their link, and its options
+	linked, skipped := 0, 0
+	configMutex.Lock()
+	for _, pair := range proposal.pairs {
+		if _, exists := config.Guilds[proposal.guildID][pair.voice.ID]; exists {
+			skipped++
+			continue
+		}
+		addLink(proposal.guildID, pair.voice.ID, pair.text.ID, proposal.userID)
+		linked++
+	}
+	configMutex.Unlock()
+	go saveConfig()
+
+	content := fmt.Sprintf("Success! I've linked %d voice channels.", linked)
+	if skipped != 0 {
+		content += fmt.Sprintf(" %d voice channels were linked in the meantime, I've left those alone.", skipped)
+	}
+
+	log.Printf("User %s has automatically linked %d voice channels in guild %s.\n", event.Member.User.String(), linked, proposal.guildID)
+	updateComponentMessage(discord, event.Interaction, &discordgo.MessageSend{
+		Content:    content,
+		Embeds:     event.Message.Embeds,
+		Components: []discordgo.MessageComponent{},
+	})
+
+	triggerGuildUpdate(discord, proposal.guildID)
+}
+
+// proposeLinks pairs every unlinked voice channel with a text channel, either by matching the names against the
+// templates, or by picking the text channel in the same category. Voice channels without a single clear match are
+// skipped. The caller is expected to hold a lock on configMutex.
+func proposeLinks(guild *discordgo.Guild, links guildChannels, byCategory bool, templates []string) []autoLinkPair {
+	var voices, texts []*discordgo.Channel
+	for _, channel := range guild.Channels {
+		switch channel.Type {
+		case discordgo.ChannelTypeGuildVoice:
+			if _, linked := links[channel.ID]; !linked {
+				voices = append(voices, channel)
+			}
+		case discordgo.ChannelTypeGuildText:
+			texts = append(texts, channel)
+		}
+	}
+
+	var pairs []autoLinkPair
+	for _, voice := range voices {
+		// Find all text channels matching the naming rules
+		var named []*discordgo.Channel
+		for _, template := range templates {
+			name := strings.Replace(strings.ToLower(template), "{name}", channelSlug(voice.Name), -1)
+			for _, text := range texts {
+				if strings.ToLower(text.Name) == name {
+					named = append(named, text)
+				}
+			}
+		}
+
+		// And those in the same category
+		var sameCategory []*discordgo.Channel
+		for _, text := range texts {
+			if voice.ParentID != "" && text.ParentID == voice.ParentID {
+				sameCategory = append(sameCategory, text)
+			}
+		}
+
+		candidates := named
+		if byCategory {
+			candidates = sameCategory
+		}
+
+		// If there are several candidates, prefer the ones that match both by name and by category
+		if len(candidates) > 1 {
+			var narrowed []*discordgo.Channel
+			for _, candidate := range candidates {
+				if (byCategory && containsChannel(named, candidate)) || (!byCategory && containsChannel(sameCategory, candidate)) {
+					narrowed = append(narrowed, candidate)
+				}
+			}
+			candidates = narrowed
+		}
+
+		if len(candidates) == 1 {
+			pairs = append(pairs, autoLinkPair{voice: voice, text: candidates[0]})
+		}
+	}
+
+	return pairs
+}
+
+// channelSlug converts a voice channel name to the form Discord uses for text channel names, e.g. "Squad 3" becomes
+// "squad-3".
+func channelSlug(name string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			slug.WriteRune(r)
+			dash = false
+		case (unicode.IsSpace(r) || r == '-') && !dash:
+			slug.WriteRune('-')
+			dash = true
+		}
+	}
+
+	return strings.Trim(slug.String(), "-")
+}
+
+// containsChannel checks whether the channel is in the list
+func containsChannel(list []*discordgo.Channel, channel *discordgo.Channel) bool {
+	for _, entry := range list {
+		if entry.ID == channel.ID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestChannelSlug(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"squad-1", "squad-1"},
+		{"Squad 1", "squad-1"},
+		{"  Squad   1  ", "squad-1"},
+		{"Squad - 1", "squad-1"},
+		{"🔊 Squad 1", "squad-1"},
+		{"Squad #1!", "squad-1"},
+		{"Squad#1", "squad1"},
+		{"under_score", "under_score"},
+		{"Ünïcode Chät", "ünïcode-chät"},
+		{"--general--", "general"},
+		{"🔊", ""},
+	}
+
+	for _, test := range tests {
+		if got := channelSlug(test.name); got != test.want {
+			t.Errorf("channelSlug(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
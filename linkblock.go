@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// sweepInterval is how often expired blocks and guest passes are removed from the config
+const sweepInterval = time.Minute
+
+func init() {
+	registerCommand(&command{
+		name: "voicelinkblock",
+		arguments: []argument{
+			{name: "user", description: "The member to keep out of the linked text channel.", typ: argumentUser},
+			{name: "voice", description: "The linked voice channel, leave out for the links of this text channel.", typ: argumentVoiceChannel, optional: true},
+			{name: "duration", description: "How long the block lasts, like 30m or 7d. Leave out to block until unblocked.", typ: argumentString, optional: true, match: isDuration},
+		},
+		permission: permissionManager,
+		help:       "Keeps a member out of a linked text channel, even while they're in voice.",
+		handler:    blockCommand,
+	})
+
+	registerCommand(&command{
+		name: "voicelinkunblock",
+		arguments: []argument{
+			{name: "user", description: "The member to allow in the linked text channel again.", typ: argumentUser},
+			{name: "voice", description: "The linked voice channel, leave out for the links of this text channel.", typ: argumentVoiceChannel, optional: true},
+		},
+		permission: permissionManager,
+		help:       "Removes the block of a member, so they get access to the linked text channel again while in voice.",
+		handler:    unblockCommand,
+	})
+
+	registerCommand(&command{
+		name: "voicelinkblocks",
+		arguments: []argument{
+			{name: "voice", description: "Only show the blocks of the link of this voice channel.", typ: argumentVoiceChannel, optional: true},
+		},
+		permission: permissionManager,
+		help:       "Lists the members that are blocked from linked text channels.",
+		handler:    listBlocksCommand,
+	})
+}
+
+func blockCommand(ctx *commandContext) {
+	member := ctx.guildMember("user")
+	if member.User.ID == ctx.discord.State.User.ID {
+		ctx.respond("I can't block myself.")
+		return
+	}
+
+	var until *time.Time
+	if value := ctx.arg("duration"); value != "" {
+		duration, err := parseDuration(value)
+		if err != nil {
+			ctx.respondError(err)
+			return
+		}
+		expiry := time.Now().Add(duration)
+		until = &expiry
+	}
+
+	configMutex.Lock()
+	voiceIDs, err := blockTargets(ctx)
+	if err != nil {
+		configMutex.Unlock()
+		ctx.respondError(err)
+		return
+	}
+
+	for _, voiceID := range voiceIDs {
+		link := config.Guilds[ctx.guildID][voiceID]
+		link.Blocks = removeBlock(link.Blocks, member.User.ID)
+		link.Blocks = append(link.Blocks, &linkBlock{UserID: member.User.ID, By: ctx.user.ID, At: time.Now(), Until: until})
+		link.recordChange(ctx.user.ID, "Blocked <@"+member.User.ID+">")
+	}
+	configMutex.Unlock()
+	go saveConfig()
+
+	// Take away their current access
+	reevaluateMember(ctx.discord, ctx.guildID, member.User.ID)
+
+	log.Printf("User %s has blocked %s from the links of voice channels %s.\n", ctx.user.String(), member.User.String(), strings.Join(voiceIDs, ", "))
+	response := "Success! " + member.User.String() + " is blocked from " + describeBlockTargets(ctx.discord, voiceIDs)
+	if until != nil {
+		response += fmt.Sprintf(" until <t:%d:f>", until.Unix())
+	}
+	ctx.respond(response + ".")
+}
+
+func unblockCommand(ctx *commandContext) {
+	member := ctx.guildMember("user")
+
+	configMutex.Lock()
+	voiceIDs, err := blockTargets(ctx)
+	if err != nil {
+		configMutex.Unlock()
+		ctx.respondError(err)
+		return
+	}
+
+	var unblocked []snowflake
+	for _, voiceID := range voiceIDs {
+		link := config.Guilds[ctx.guildID][voiceID]
+		if link.findBlock(member.User.ID) == nil {
+			continue
+		}
+		link.Blocks = removeBlock(link.Blocks, member.User.ID)
+		link.recordChange(ctx.user.ID, "Unblocked <@"+member.User.ID+">")
+		unblocked = append(unblocked, voiceID)
+	}
+	configMutex.Unlock()
+
+	if len(unblocked) == 0 {
+		ctx.respond(member.User.String() + " is not blocked from " + describeBlockTargets(ctx.discord, voiceIDs) + ".")
+		return
+	}
+	go saveConfig()
+
+	// Give them their access back if they're in voice
+	reevaluateMember(ctx.discord, ctx.guildID, member.User.ID)
+
+	log.Printf("User %s has unblocked %s from the links of voice channels %s.\n", ctx.user.String(), member.User.String(), strings.Join(unblocked, ", "))
+	ctx.respond("Success! " + member.User.String() + " is no longer blocked from " + describeBlockTargets(ctx.discord, unblocked) + ".")
+}
+
+func listBlocksCommand(ctx *commandContext) {
+	configMutex.RLock()
+	links := config.Guilds[ctx.guildID]
+	if voice := ctx.channel("voice"); voice != nil {
+		link, exists := links[voice.ID]
+		if !exists {
+			configMutex.RUnlock()
+			ctx.respond("That is not a registered voice channel in this server.")
+			return
+		}
+		links = guildChannels{voice.ID: link}
+	}
+
+	var lines []string
+	for voiceID, link := range links {
+		for _, block := range link.Blocks {
+			if block.expired() {
+				continue
+			}
+
+			line := fmt.Sprintf("• <@%s> from %s by <@%s> <t:%d:R>", block.UserID, describeBlockTargets(ctx.discord, []snowflake{voiceID}), block.By, block.At.Unix())
+			if block.Until != nil {
+				line += fmt.Sprintf(", until <t:%d:f>", block.Until.Unix())
+			}
+			lines = append(lines, line)
+		}
+	}
+	configMutex.RUnlock()
+
+	if len(lines) == 0 {
+		ctx.respond("Nobody is blocked from any linked text channel.")
+		return
+	}
+
+	sort.Strings(lines)
+	ctx.send(&discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{{
+			Title:       "Blocked members",
+			Description: truncate(strings.Join(lines, "\n"), 4096),
+			Color:       colorLinkList,
+		}},
+	})
+}
+
+// blockTargets returns the voice channels whose links a block command applies to: the given voice channel, or else
+// all voice channels linked to the text channel the command is used in.
+// The caller is expected to hold a lock on configMutex.
+func blockTargets(ctx *commandContext) ([]snowflake, error) {
+	links := config.Guilds[ctx.guildID]
+	if voice := ctx.channel("voice"); voice != nil {
+		if _, exists := links[voice.ID]; !exists {
+			return nil, userError("That is not a registered voice channel in this server.")
+		}
+		return []snowflake{voice.ID}, nil
+	}
+
+	var voiceIDs []snowflake
+	for voiceID, link := range links {
+		if link.TextChannelID == ctx.channelID {
+			voiceIDs = append(voiceIDs, voiceID)
+		}
+	}
+	if len(voiceIDs) == 0 {
+		return nil, userError("This channel is not linked to a voice channel, please tell me which voice channel you mean.")
+	}
+	sort.Strings(voiceIDs)
+
+	return voiceIDs, nil
+}
+
+// describeBlockTargets lists the links of the voice channels by name, for use in responses
+func describeBlockTargets(discord *discordgo.Session, voiceIDs []snowflake) string {
+	names := make([]string, len(voiceIDs))
+	for i, voiceID := range voiceIDs {
+		names[i] = "the link of 🔊 " + voiceID
+		if voice, err := getChannel(discord, voiceID); err == nil {
+			names[i] = "the link of 🔊 " + voice.Name
+		}
+	}
+
+	return strings.Join(names, " and ")
+}
+
+// findBlock returns the block of the user on this link, or nil if they're not blocked (anymore)
+func (link *voiceLink) findBlock(userID snowflake) *linkBlock {
+	for _, block := range link.Blocks {
+		if block.UserID == userID && !block.expired() {
+			return block
+		}
+	}
+
+	return nil
+}
+
+// expired checks whether the block has run out
+func (block *linkBlock) expired() bool {
+	return block.Until != nil && !block.Until.After(time.Now())
+}
+
+// removeBlock returns the blocks without the ones of the given user
+func removeBlock(blocks []*linkBlock, userID snowflake) []*linkBlock {
+	var filtered []*linkBlock
+	for _, block := range blocks {
+		if block.UserID != userID {
+			filtered = append(filtered, block)
+		}
+	}
+
+	return filtered
+}
+
+// sweepExpired periodically removes expired blocks and guest passes from the config, and brings the access of those
+// members up to date. This also picks up the ones that expired while we were offline.
+func sweepExpired() {
+	type expiredEntry struct {
+		guildID snowflake
+		userID  snowflake
+		what    string
+	}
+
+	for range time.Tick(sweepInterval) {
+		configMutex.Lock()
+		var expired []expiredEntry
+		for guildID, links := range config.Guilds {
+			for _, link := range links {
+				var blocks []*linkBlock
+				for _, block := range link.Blocks {
+					if block.expired() {
+						expired = append(expired, expiredEntry{guildID, block.UserID, "block"})
+					} else {
+						blocks = append(blocks, block)
+					}
+				}
+				link.Blocks = blocks
+
+				var guests []*linkGuest
+				for _, guest := range link.Guests {
+					if guest.expired() {
+						expired = append(expired, expiredEntry{guildID, guest.UserID, "guest pass"})
+					} else {
+						guests = append(guests, guest)
+					}
+				}
+				link.Guests = guests
+			}
+		}
+		configMutex.Unlock()
+
+		if len(expired) == 0 {
+			continue
+		}
+		go saveConfig()
+
+		for _, entry := range expired {
+			log.Printf("The %s of user %s in guild %s has expired.\n", entry.what, entry.userID, entry.guildID)
+			reevaluateMember(discord, entry.guildID, entry.userID)
+		}
+	}
+}
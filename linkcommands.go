@@ -0,0 +1,113 @@
+package main
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func init() {
+	registerCommand(&command{
+		name: "voicelink",
+		arguments: []argument{
+			{name: "voice", description: "The voice channel to link.", typ: argumentVoiceChannel},
+			{name: "text", description: "The text channel members of the voice channel should get access to.", typ: argumentTextChannel},
+		},
+		permission: permissionManager,
+		help:       "Links a voice channel to a text channel, members in the voice channel will be able to see the text channel.",
+		handler:    linkCommand,
+	})
+
+	registerCommand(&command{
+		name: "voiceunlink",
+		arguments: []argument{
+			{name: "voice", description: "The voice channel to unlink.", typ: argumentVoiceChannel},
+		},
+		permission: permissionManager,
+		help:       "Removes the link of a voice channel.",
+		handler:    unlinkCommand,
+	})
+}
+
+func linkCommand(ctx *commandContext) {
+	voice, text := ctx.channel("voice"), ctx.channel("text")
+
+	// Add it to the list
+	configMutex.Lock()
+	previous := config.Guilds[ctx.guildID][voice.ID]
+	releaseEphemeralChannel(ctx.discord, voice.ID, previous)
+	addLink(ctx.guildID, voice.ID, text.ID, ctx.user.ID)
+	configMutex.Unlock()
+	go saveConfig()
+
+	// Send a confirmation
+	ctx.respond("Success! I've linked the voice channel " + voice.Name + " to the text channel " + text.Mention() + ".")
+
+	// And trigger a guild update
+	triggerGuildUpdate(ctx.discord, ctx.guildID)
+}
+
+func unlinkCommand(ctx *commandContext) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	// Check if this guild even has any registered channels
+	channels, guildKnown := config.Guilds[ctx.guildID]
+	if !guildKnown {
+		ctx.respond("I know no registered channels for this server.")
+		return
+	}
+
+	// Check if the requested channel is registered
+	voiceID := ctx.channel("voice").ID
+	if _, channelRegistered := channels[voiceID]; !channelRegistered {
+		ctx.respond("That is not a registered voice channel in this server.")
+		return
+	}
+
+	// Remove it from the list
+	removeLink(ctx.discord, ctx.guildID, voiceID)
+	go saveConfig()
+
+	// Send a confirmation
+	ctx.respond("Success! I've unlinked that voice channel!")
+
+	// And trigger a guild update
+	triggerGuildUpdate(ctx.discord, ctx.guildID)
+}
+
+// removeLink removes the link of the voice channel, disposing of its ephemeral text channel if it has one.
+// The caller is expected to hold a write lock on configMutex, and to save the config afterwards.
+func removeLink(discord *discordgo.Session, guildID, voiceID snowflake) {
+	channels := config.Guilds[guildID]
+	link, exists := channels[voiceID]
+	if !exists {
+		return
+	}
+
+	releaseEphemeralChannel(discord, voiceID, link)
+	delete(channels, voiceID)
+	if len(channels) == 0 {
+		delete(config.Guilds, guildID)
+	}
+}
+
+// addLink links the voice channel to the text channel, replacing any existing link of that voice channel.
+// The caller is expected to hold a write lock on configMutex, and to save the config afterwards.
+func addLink(guildID, voiceID, textID, userID snowflake) *voiceLink {
+	list, exists := config.Guilds[guildID]
+	if !exists {
+		list = make(guildChannels)
+		config.Guilds[guildID] = list
+	}
+
+	now := time.Now()
+	link := &voiceLink{
+		TextChannelID: textID,
+		LinkedBy:      userID,
+		LinkedAt:      &now,
+	}
+	list[voiceID] = link
+
+	return link
+}
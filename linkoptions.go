@@ -0,0 +1,221 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// linkOption describes a setting of a link that can be changed with voicelinkset
+type linkOption struct {
+	name        string
+	description string
+	// set parses and applies the value to the link, an empty value resets the option to its default.
+	// It is called with a write lock on configMutex. Errors are shown to the user.
+	set func(ctx *commandContext, link *voiceLink, value string) error
+	// show describes the current value, or returns an empty string if the option is at its default.
+	show func(link *voiceLink) string
+	// changed is called after the option has been changed and the config lock has been released, optional
+	changed func(ctx *commandContext, voiceID snowflake)
+}
+
+var linkOptions = make(map[string]*linkOption)
+
+// registerLinkOption makes an option available to voicelinkset, and shows it in the link list
+func registerLinkOption(option *linkOption) {
+	linkOptions[option.name] = option
+}
+
+// sortedLinkOptions returns the registered link options, sorted by name
+func sortedLinkOptions() []*linkOption {
+	sorted := make([]*linkOption, 0, len(linkOptions))
+	for _, option := range linkOptions {
+		sorted = append(sorted, option)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].name < sorted[j].name
+	})
+
+	return sorted
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "voicelinkset",
+		aliases: []string{"voicelinkoption"},
+		arguments: []argument{
+			{name: "voice", description: "The linked voice channel.", typ: argumentVoiceChannel},
+			{name: "option", description: "The option to change, leave out to see all options of the link.", typ: argumentString, optional: true},
+			{name: "value", description: "The new value of the option, leave out to reset it to its default.", typ: argumentString, optional: true, rest: true},
+		},
+		permission: permissionManager,
+		help:       "Shows or changes the options of a link.",
+		handler:    setOptionCommand,
+	})
+}
+
+func setOptionCommand(ctx *commandContext) {
+	voice := ctx.channel("voice")
+	name := strings.ToLower(ctx.arg("option"))
+
+	configMutex.Lock()
+	link, exists := config.Guilds[ctx.guildID][voice.ID]
+	if !exists {
+		configMutex.Unlock()
+		ctx.respond("That is not a registered voice channel in this server.")
+		return
+	}
+
+	// Without an option, list all options and their current values
+	if name == "" {
+		lines := []string{"These are the options of the link of " + voice.Name + ":", ""}
+		for _, option := range sortedLinkOptions() {
+			value := option.show(link)
+			if value == "" {
+				value = "default"
+			}
+			lines = append(lines, "• `"+option.name+"` ("+value+"): "+option.description)
+		}
+		configMutex.Unlock()
+
+		ctx.respondLines(lines)
+		return
+	}
+
+	option, known := linkOptions[name]
+	if !known {
+		configMutex.Unlock()
+
+		var names []string
+		for _, option := range sortedLinkOptions() {
+			names = append(names, option.name)
+		}
+		ctx.respond("I don't know that option, the options are: `" + strings.Join(names, "`, `") + "`.")
+		return
+	}
+
+	if err := option.set(ctx, link, ctx.arg("value")); err != nil {
+		configMutex.Unlock()
+		ctx.respondError(err)
+		return
+	}
+
+	value := option.show(link)
+	if value == "" {
+		value = "default"
+	}
+	link.recordChange(ctx.user.ID, "Option "+option.name+" set to "+value)
+	configMutex.Unlock()
+	go saveConfig()
+
+	log.Printf("User %s has set option %s of the link of voice channel %s to %s.\n", ctx.user.String(), option.name, voice.Name, value)
+	ctx.respond("Success! The option `" + option.name + "` of the link of " + voice.Name + " is now " + value + ".")
+
+	if option.changed != nil {
+		option.changed(ctx, voice.ID)
+	}
+}
+
+// refreshGuild is the changed handler of options that affect who gets access, it brings all overwrites of the guild
+// up to date with the new setting
+func refreshGuild(ctx *commandContext, _ snowflake) {
+	triggerGuildUpdate(ctx.discord, ctx.guildID)
+}
+
+// switchOption creates an on/off option, field returns the setting of the link it changes
+func switchOption(name, description string, field func(link *voiceLink) *bool) *linkOption {
+	return &linkOption{
+		name:        name,
+		description: description,
+		set: func(_ *commandContext, link *voiceLink, value string) error {
+			enabled, err := parseSwitch(value)
+			if err != nil {
+				return err
+			}
+			*field(link) = enabled
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			if !*field(link) {
+				return ""
+			}
+			return "on"
+		},
+	}
+}
+
+// parseOptionalDuration parses a duration option, an empty value resets it to zero
+func parseOptionalDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return parseDuration(value)
+}
+
+// parseRoles parses a list of roles separated by spaces or commas, given by their mentions, IDs or names
+func parseRoles(ctx *commandContext, value string) ([]snowflake, error) {
+	var roles []snowflake
+	for _, target := range strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' }) {
+		role, err := resolveRole(ctx.discord, ctx.guildID, target)
+		if err != nil {
+			return nil, err
+		}
+		if !containsSnowflake(roles, role.ID) {
+			roles = append(roles, role.ID)
+		}
+	}
+
+	return roles, nil
+}
+
+// parseChannel resolves a channel an option points to, by its mention, ID or name. Like the channels a command is
+// invoked with, the invoker needs to be able to use it: see it and send messages in it, and manage it if the guild
+// requires channel permissions. The caller is expected to hold a lock on configMutex.
+func parseChannel(ctx *commandContext, value string, channelType discordgo.ChannelType) (*discordgo.Channel, error) {
+	channel, err := resolveChannel(ctx.discord, ctx.guildID, value, channelType)
+	if err != nil {
+		return nil, err
+	}
+
+	required := int64(discordgo.PermissionViewChannel | discordgo.PermissionSendMessages)
+	if settings, exists := config.Settings[ctx.guildID]; exists && settings.RequireChannelPermission &&
+		!isAdmin(ctx.permissions) && !isLinkManager(ctx.guildID, ctx.member) {
+		required |= discordgo.PermissionManageChannels
+	}
+
+	permissions, err := computeOverwrites(ctx.permissions, ctx.member, channel)
+	if err != nil || !hasPermission(permissions, required) {
+		if hasPermission(required, discordgo.PermissionManageChannels) {
+			return nil, userError("You need the Manage Channels permission on " + channel.Mention() + " to use it for this option.")
+		}
+		return nil, userError("You need to be able to see and send messages in " + channel.Mention() + " to use it for this option.")
+	}
+
+	return channel, nil
+}
+
+// showRoles describes a list of roles as mentions, which don't ping anyone in our responses
+func showRoles(roles []snowflake) string {
+	mentions := make([]string, len(roles))
+	for i, roleID := range roles {
+		mentions[i] = "<@&" + roleID + ">"
+	}
+
+	return strings.Join(mentions, " ")
+}
+
+// parseSwitch parses the values we accept for on/off options
+func parseSwitch(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on", "yes", "true", "enable", "enabled":
+		return true, nil
+	case "", "off", "no", "false", "disable", "disabled":
+		return false, nil
+	}
+
+	return false, userError("Please use `on` or `off`.")
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	linksPerPage     = 10
+	maxBrokenListed  = 15
+	colorLinkList    = 0x5865F2
+	colorBrokenLinks = 0xED4245
+)
+
+// linkListEntry is a single link as shown in the link list
+type linkListEntry struct {
+	voiceID snowflake
+	link    *voiceLink
+	voice   *discordgo.Channel
+	text    *discordgo.Channel
+	problem string // Empty if the link works
+}
+
+func init() {
+	registerCommand(&command{
+		name:       "voicelinklist",
+		permission: permissionManager,
+		help:       "Lists all channel links in this server, including links that no longer work.",
+		handler:    listCommand,
+	})
+
+	registerComponent("voicelinklist", onListPageButton)
+	registerComponent("voicelinkprune", onPruneButton)
+}
+
+func listCommand(ctx *commandContext) {
+	message, ok := renderLinkList(ctx.discord, ctx.guildID, ctx.user.ID, 0)
+	if !ok {
+		ctx.respond("I know no registered channels for this server.")
+		return
+	}
+
+	ctx.send(message)
+}
+
+// onListPageButton handles the navigation buttons of the link list, the args are the user and the requested page.
+func onListPageButton(discord *discordgo.Session, event *discordgo.InteractionCreate, args []string) {
+	if len(args) != 2 || !isComponentOwner(discord, event, args[0]) {
+		return
+	}
+
+	page, _ := strconv.Atoi(args[1])
+	message, ok := renderLinkList(discord, event.GuildID, args[0], page)
+	if !ok {
+		message = &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{}, Components: []discordgo.MessageComponent{}}
+		message.Content = "I know no registered channels for this server."
+	} else if event.Message != nil {
+		message.Content = event.Message.Content
+	}
+
+	updateComponentMessage(discord, event.Interaction, message)
+}
+
+// onPruneButton handles the button offering to remove all broken links, the args are the user that requested the list.
+func onPruneButton(discord *discordgo.Session, event *discordgo.InteractionCreate, args []string) {
+	if len(args) != 1 || !isComponentOwner(discord, event, args[0]) {
+		return
+	}
+
+	// Collect the broken links again, things might have changed since the list was sent
+	configMutex.RLock()
+	_, broken := collectLinks(discord, event.GuildID)
+	configMutex.RUnlock()
+
+	// Only remove the links that weren't changed in the meantime
+	configMutex.Lock()
+	for _, entry := range broken {
+		if config.Guilds[event.GuildID][entry.voiceID] == entry.link {
+			removeLink(discord, event.GuildID, entry.voiceID)
+		}
+	}
+	configMutex.Unlock()
+
+	if len(broken) != 0 {
+		log.Printf("User %s has removed %d broken links in guild %s.\n", event.Member.User.String(), len(broken), event.GuildID)
+		go saveConfig()
+		triggerGuildUpdate(discord, event.GuildID)
+	}
+
+	message, ok := renderLinkList(discord, event.GuildID, args[0], 0)
+	if !ok {
+		message = &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{}, Components: []discordgo.MessageComponent{}}
+	}
+	message.Content = fmt.Sprintf("Removed %d broken links.", len(broken))
+	updateComponentMessage(discord, event.Interaction, message)
+}
+
+// isComponentOwner checks whether the component interaction comes from the user the component was created for.
+// If not, it tells the user so.
+func isComponentOwner(discord *discordgo.Session, event *discordgo.InteractionCreate, userID snowflake) bool {
+	if event.Member.User.ID == userID {
+		return true
+	}
+
+	respondEphemeral(discord, event.Interaction, "Only the person that used the command can use these buttons.")
+	return false
+}
+
+// collectLinks gathers all links of a guild, split in links that work and links whose channels no longer exist or
+// are no longer of the right type. Both are sorted by voice channel position.
+// The caller is expected to hold a read lock on configMutex.
+func collectLinks(discord *discordgo.Session, guildID snowflake) (working, broken []linkListEntry) {
+	for voiceID, link := range config.Guilds[guildID] {
+		entry := linkListEntry{voiceID: voiceID, link: link}
+
+		voice, err := getChannel(discord, voiceID)
+		var text *discordgo.Channel
+		var textErr error
+		if link.TextChannelID != "" || link.Ephemeral == "" {
+			text, textErr = getChannel(discord, link.TextChannelID)
+		}
+		switch {
+		case err != nil:
+			entry.problem = "The voice channel no longer exists or I can't see it."
+		case voice.Type != discordgo.ChannelTypeGuildVoice:
+			entry.problem = "The voice channel is no longer a voice channel."
+		case text == nil && textErr == nil:
+			// Ephemeral link while nobody is in voice
+		case textErr != nil:
+			entry.problem = "The text channel no longer exists or I can't see it."
+		case text.Type != discordgo.ChannelTypeGuildText:
+			entry.problem = "The text channel is no longer a text channel."
+		}
+		entry.voice, entry.text = voice, text
+
+		if entry.problem != "" {
+			broken = append(broken, entry)
+		} else {
+			working = append(working, entry)
+		}
+	}
+
+	sort.Slice(working, func(i, j int) bool {
+		if working[i].voice.Position != working[j].voice.Position {
+			return working[i].voice.Position < working[j].voice.Position
+		}
+		return working[i].voiceID < working[j].voiceID
+	})
+	sort.Slice(broken, func(i, j int) bool {
+		return broken[i].voiceID < broken[j].voiceID
+	})
+
+	return
+}
+
+// renderLinkList builds a page of the link list for the given guild. The buttons on it only work for the given user.
+// Returns false if the guild has no links at all.
+func renderLinkList(discord *discordgo.Session, guildID, userID snowflake, page int) (*discordgo.MessageSend, bool) {
+	configMutex.RLock()
+	working, broken := collectLinks(discord, guildID)
+
+	// Count the members in each voice channel
+	occupancy := make(map[snowflake]int)
+	if guild, err := getGuild(discord, guildID); err == nil {
+		for _, state := range guild.VoiceStates {
+			occupancy[state.ChannelID]++
+		}
+	}
+
+	pages := (len(working) + linksPerPage - 1) / linksPerPage
+	if pages == 0 {
+		pages = 1
+	}
+	if page < 0 || page >= pages {
+		page = 0
+	}
+
+	list := &discordgo.MessageEmbed{
+		Title:  "Linked voice channels",
+		Color:  colorLinkList,
+		Footer: &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Page %d of %d, %d links", page+1, pages, len(working))},
+	}
+	if len(working) == 0 {
+		list.Description = "None of the links in this server work at the moment."
+	}
+
+	for i := page * linksPerPage; i < len(working) && i < (page+1)*linksPerPage; i++ {
+		entry := working[i]
+		value := "Text channel is created when someone joins"
+		if entry.text != nil {
+			value = "Linked to " + entry.text.Mention()
+		}
+		value += fmt.Sprintf("\nIn voice: %d", occupancy[entry.voiceID])
+		for _, option := range describeLink(entry.link) {
+			value += "\n" + option
+		}
+
+		list.Fields = append(list.Fields, &discordgo.MessageEmbedField{
+			Name:  truncate("🔊 "+entry.voice.Name, 256),
+			Value: truncate(value, 1024),
+		})
+	}
+	configMutex.RUnlock()
+
+	if len(working) == 0 && len(broken) == 0 {
+		return nil, false
+	}
+
+	message := &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{list}}
+	var buttons []discordgo.MessageComponent
+	if pages > 1 {
+		buttons = append(buttons,
+			discordgo.Button{
+				Label:    "Previous",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("voicelinklist:%s:%d", userID, page-1),
+				Disabled: page == 0,
+			},
+			discordgo.Button{
+				Label:    "Next",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("voicelinklist:%s:%d", userID, page+1),
+				Disabled: page == pages-1,
+			},
+		)
+	}
+
+	// Broken links get their own section, along with the offer to clean them up
+	if len(broken) != 0 {
+		brokenList := &discordgo.MessageEmbed{
+			Title: "Broken links",
+			Color: colorBrokenLinks,
+		}
+		for i, entry := range broken {
+			if i == maxBrokenListed {
+				brokenList.Description = fmt.Sprintf("And %d more.", len(broken)-maxBrokenListed)
+				break
+			}
+
+			name := "Voice channel " + entry.voiceID
+			if entry.voice != nil {
+				name = "🔊 " + entry.voice.Name
+			}
+			brokenList.Fields = append(brokenList.Fields, &discordgo.MessageEmbedField{
+				Name:  truncate(name, 256),
+				Value: entry.problem,
+			})
+		}
+		message.Embeds = append(message.Embeds, brokenList)
+
+		buttons = append(buttons, discordgo.Button{
+			Label:    fmt.Sprintf("Remove %d broken links", len(broken)),
+			Style:    discordgo.DangerButton,
+			CustomID: "voicelinkprune:" + userID,
+		})
+	}
+
+	message.Components = []discordgo.MessageComponent{}
+	if len(buttons) != 0 {
+		message.Components = append(message.Components, discordgo.ActionsRow{Components: buttons})
+	}
+
+	return message, true
+}
+
+// describeLink returns a line for each setting of the link worth mentioning in the link list
+func describeLink(link *voiceLink) []string {
+	var lines []string
+	if link.LinkedBy != "" {
+		line := "Linked by <@" + link.LinkedBy + ">"
+		if link.LinkedAt != nil {
+			line += fmt.Sprintf(" <t:%d:R>", link.LinkedAt.Unix())
+		}
+		lines = append(lines, line)
+	}
+	for _, option := range sortedLinkOptions() {
+		if value := option.show(link); value != "" {
+			lines = append(lines, "Option "+option.name+": "+value)
+		}
+	}
+	if change := lastChange(link); change != nil {
+		lines = append(lines, fmt.Sprintf("Last change: %s by <@%s> <t:%d:R>", change.Description, change.By, change.At.Unix()))
+	}
+
+	return lines
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+func init() {
+	registerCommand(&command{
+		name: "voicemanager",
+		arguments: []argument{
+			{name: "action", description: "Whether to add, remove or list link managers.", typ: argumentString, choices: []string{"add", "remove", "list"}},
+			{name: "target", description: "The role or user to add or remove.", typ: argumentMentionable, optional: true},
+		},
+		permission: permissionAdmin,
+		help:       "Manages the roles and users that may manage links without the Manage Channels permission.",
+		handler:    managerCommand,
+	})
+
+	registerCommand(&command{
+		name: "voicemanagermode",
+		arguments: []argument{
+			{name: "mode", description: "\"server\" to check Manage Channels server-wide, \"channel\" to check it on the channels being linked.", typ: argumentString, choices: []string{"server", "channel"}, optional: true},
+		},
+		permission: permissionAdmin,
+		help:       "Shows or changes whether the Manage Channels permission is checked server-wide or on the channels being linked.",
+		handler:    managerModeCommand,
+	})
+}
+
+// targetMessages are the responses of editTargets. The added and removed ones follow the name of the target.
+type targetMessages struct {
+	what    string // What the roles and users are, for the log
+	empty   string
+	list    string // Followed by the roles and users
+	exists  string
+	added   string
+	missing string
+	removed string
+}
+
+// modeMessages are the responses of switchMode, for the setting being on or off
+type modeMessages struct {
+	what string // What the setting is, for the log
+	on   string
+	off  string
+}
+
+func managerCommand(ctx *commandContext) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	settings := getGuildSettings(ctx.guildID)
+	editTargets(ctx, &settings.ManagerRoles, &settings.ManagerUsers, nil, targetMessages{
+		what:    "link managers",
+		empty:   "There are no link managers in this server, only members with the Manage Channels permission can manage links.",
+		list:    "These roles and users can manage links: ",
+		exists:  " is already a link manager.",
+		added:   " can now manage links.",
+		missing: " is not a link manager.",
+		removed: " can no longer manage links.",
+	})
+}
+
+func managerModeCommand(ctx *commandContext) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	settings := getGuildSettings(ctx.guildID)
+	switchMode(ctx, &settings.RequireChannelPermission, "channel", modeMessages{
+		what: "manager mode",
+		on:   "Members need the Manage Channels permission on the channels they link.",
+		off:  "Members need the Manage Channels permission server-wide to manage links.",
+	})
+}
+
+// editTargets adds, removes or lists the roles and users of a guild setting, as asked by the action and target
+// arguments. Extra entries are added to the list. Returns whether the setting was changed.
+// The caller is expected to hold a write lock on configMutex.
+func editTargets(ctx *commandContext, roles, users *[]snowflake, extra []string, messages targetMessages) bool {
+	if ctx.arg("action") == "list" {
+		if len(*roles) == 0 && len(*users) == 0 && len(extra) == 0 {
+			ctx.respond(messages.empty)
+			return false
+		}
+
+		var targets []string
+		// Names rather than mentions, we don't want to ping anyone
+		for _, roleID := range *roles {
+			if role, err := getRole(ctx.discord, ctx.guildID, roleID); err == nil {
+				targets = append(targets, "role "+role.Name)
+			}
+		}
+		for _, userID := range *users {
+			targets = append(targets, getUserName(ctx.discord, ctx.guildID, userID))
+		}
+		targets = append(targets, extra...)
+
+		ctx.respond(messages.list + strings.Join(targets, ", "))
+		return false
+	}
+
+	role, member := ctx.role("target"), ctx.guildMember("target")
+	if role == nil && member == nil {
+		ctx.respondError(errUsage)
+		return false
+	}
+
+	list, id, name := users, "", ""
+	if role != nil {
+		list, id, name = roles, role.ID, "The role "+role.Name
+	} else {
+		id, name = member.User.ID, member.User.String()
+	}
+
+	if ctx.arg("action") == "add" {
+		if containsSnowflake(*list, id) {
+			ctx.respond(name + messages.exists)
+			return false
+		}
+		*list = append(*list, id)
+		ctx.respond("Success! " + name + messages.added)
+	} else {
+		if !containsSnowflake(*list, id) {
+			ctx.respond(name + messages.missing)
+			return false
+		}
+		*list = removeSnowflake(*list, id)
+		ctx.respond("Success! " + name + messages.removed)
+	}
+
+	log.Printf("User %s has changed the %s of guild %s: %s %s\n", ctx.user.String(), messages.what, ctx.guildID, ctx.arg("action"), id)
+	go saveConfig()
+	return true
+}
+
+// switchMode shows or changes an on/off guild setting through the mode argument, onMode being the one that turns it
+// on. Without a mode it shows the current one. Returns whether the setting was changed.
+// The caller is expected to hold a write lock on configMutex.
+func switchMode(ctx *commandContext, setting *bool, onMode string, messages modeMessages) bool {
+	mode := ctx.arg("mode")
+	if mode == "" {
+		if *setting {
+			ctx.respond(messages.on)
+		} else {
+			ctx.respond(messages.off)
+		}
+		return false
+	}
+
+	*setting = mode == onMode
+	log.Printf("User %s has changed the %s of guild %s to %s\n", ctx.user.String(), messages.what, ctx.guildID, mode)
+	go saveConfig()
+	if *setting {
+		ctx.respond("Success! " + messages.on)
+	} else {
+		ctx.respond("Success! " + messages.off)
+	}
+	return true
+}
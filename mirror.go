@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	mirrorWebhookName = "Voice chat mirror"
+	// maxMirroredMessages is the amount of mirrored messages we remember, so edits and deletions can be mirrored too
+	maxMirroredMessages = 1000
+	// maxForwardedFileSize is the largest attachment we upload again, larger ones are linked instead
+	maxForwardedFileSize = 8 * 1024 * 1024
+)
+
+// mirroredMessage is the copy of a message in the other channel
+type mirroredMessage struct {
+	messageID snowflake
+	webhook   *discordgo.Webhook
+}
+
+var (
+	mirrorMutex sync.Mutex
+	// mirrorWebhooks contains the webhook we use to post in each channel, the key is the channel ID
+	mirrorWebhooks = make(map[snowflake]*discordgo.Webhook)
+	// mirroredMessages contains the copies of each mirrored message, the key is the original message ID
+	mirroredMessages = make(map[snowflake][]*mirroredMessage)
+	// mirroredOrder contains the original message IDs in the order they were mirrored, to forget the oldest ones
+	mirroredOrder []snowflake
+
+	attachmentClient = &http.Client{Timeout: 30 * time.Second}
+)
+
+func init() {
+	registerLinkOption(switchOption("mirror", "`on` to relay messages between the text chat of the voice channel and the linked text channel, both ways. Everyone who can see the voice channel can read what is relayed to it.", func(link *voiceLink) *bool { return &link.Mirror }))
+
+	discord.AddHandler(onMirrorMessageCreate)
+	discord.AddHandler(onMirrorMessageUpdate)
+	discord.AddHandler(onMirrorMessageDelete)
+}
+
+// onMirrorMessageCreate copies new messages to the other side of the mirror
+func onMirrorMessageCreate(discord *discordgo.Session, event *discordgo.MessageCreate) {
+	if event.GuildID == "" || event.Author == nil || event.Author.ID == discord.State.User.ID || isMirrorWebhook(event.WebhookID) {
+		return
+	}
+
+	targets := mirrorTargets(discord, event.GuildID, event.ChannelID, event.Author.ID)
+	if len(targets) == 0 {
+		return
+	}
+
+	name := event.Author.DisplayName()
+	if event.Member != nil && event.Member.Nick != "" {
+		name = event.Member.Nick
+	}
+
+	// Upload the attachments again, or link them if they are too large
+	content := event.Content
+	var files []*discordgo.MessageAttachment
+	var contents [][]byte
+	for _, attachment := range event.Attachments {
+		if attachment.Size > maxForwardedFileSize {
+			content += "\n" + attachment.URL
+			continue
+		}
+
+		data, err := downloadAttachment(attachment.URL)
+		if err != nil {
+			log.Println("Could not download attachment to mirror.", err)
+			content += "\n" + attachment.URL
+			continue
+		}
+		files = append(files, attachment)
+		contents = append(contents, data)
+	}
+	if content == "" && len(files) == 0 {
+		return // Nothing we can mirror, like a sticker
+	}
+
+	var copies []*mirroredMessage
+	for _, target := range targets {
+		webhook, err := getMirrorWebhook(discord, target)
+		if err != nil {
+			log.Println("Could not get mirror webhook.", err)
+			continue
+		}
+
+		// Every target needs its own readers
+		var targetFiles []*discordgo.File
+		for i, file := range files {
+			targetFiles = append(targetFiles, &discordgo.File{Name: file.Filename, ContentType: file.ContentType, Reader: bytes.NewReader(contents[i])})
+		}
+
+		message, err := discord.WebhookExecute(webhook.ID, webhook.Token, true, &discordgo.WebhookParams{
+			Content:         truncate(content, 2000),
+			Username:        truncate(name, 80),
+			AvatarURL:       event.Author.AvatarURL(""),
+			Files:           targetFiles,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err != nil {
+			log.Println("Could not mirror message.", err)
+			continue
+		}
+		copies = append(copies, &mirroredMessage{messageID: message.ID, webhook: webhook})
+	}
+
+	rememberMirror(event.ID, copies)
+}
+
+// onMirrorMessageUpdate mirrors edits of mirrored messages
+func onMirrorMessageUpdate(discord *discordgo.Session, event *discordgo.MessageUpdate) {
+	mirrorMutex.Lock()
+	copies := mirroredMessages[event.ID]
+	mirrorMutex.Unlock()
+
+	// Updates without content are embeds being added to the message
+	if len(copies) == 0 || event.Content == "" {
+		return
+	}
+
+	content := truncate(event.Content, 2000)
+	for _, copied := range copies {
+		_, err := discord.WebhookMessageEdit(copied.webhook.ID, copied.webhook.Token, copied.messageID, &discordgo.WebhookEdit{
+			Content:         &content,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err != nil {
+			log.Println("Could not mirror message edit.", err)
+		}
+	}
+}
+
+// onMirrorMessageDelete mirrors deletions of mirrored messages
+func onMirrorMessageDelete(discord *discordgo.Session, event *discordgo.MessageDelete) {
+	mirrorMutex.Lock()
+	copies := mirroredMessages[event.ID]
+	delete(mirroredMessages, event.ID)
+	mirrorMutex.Unlock()
+
+	for _, copied := range copies {
+		if err := discord.WebhookMessageDelete(copied.webhook.ID, copied.webhook.Token, copied.messageID); err != nil {
+			log.Println("Could not mirror message deletion.", err)
+		}
+	}
+}
+
+// mirrorTargets returns the channels a message in the given channel should be mirrored to. For a voice channel this is
+// its linked text channel, for a text channel these are all voice channels linked to it. Links the author has no full
+// access through are left out, so blocked members can't use the mirror to get around their block.
+func mirrorTargets(discord *discordgo.Session, guildID, channelID, authorID snowflake) []snowflake {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	links := config.Guilds[guildID]
+	if link, isVoice := links[channelID]; isVoice {
+		if link.Mirror && link.TextChannelID != "" && mayMirror(discord, guildID, channelID, link, authorID) {
+			return []snowflake{link.TextChannelID}
+		}
+		return nil
+	}
+
+	var targets []snowflake
+	for voiceID, link := range links {
+		if link.Mirror && link.TextChannelID == channelID && mayMirror(discord, guildID, voiceID, link, authorID) {
+			targets = append(targets, voiceID)
+		}
+	}
+
+	return targets
+}
+
+// mayMirror checks whether the member's messages may be relayed through the link. That is the case if they're exempt,
+// or if they'd get full access to the text channel through it, either from their voice state or from a guest pass.
+// The caller is expected to hold a read lock on configMutex.
+func mayMirror(discord *discordgo.Session, guildID, voiceID snowflake, link *voiceLink, userID snowflake) bool {
+	if exemptionFor(guildID, []snowflake{voiceID}).covers(discord, guildID, userID) {
+		return true
+	}
+	if link.findBlock(userID) != nil {
+		return false
+	}
+	if link.findGuest(userID) != nil {
+		return true
+	}
+	if reason, _ := link.checkRequirements(discord, guildID, userID); reason != "" {
+		return false
+	}
+
+	guild, err := getGuild(discord, guildID)
+	if err != nil {
+		return false
+	}
+	for _, state := range guild.VoiceStates {
+		if state.UserID == userID {
+			return link.accessFor(voiceID, state) == accessFull
+		}
+	}
+
+	return false
+}
+
+// getMirrorWebhook returns the webhook we use to post in the channel, creating it if needed
+func getMirrorWebhook(discord *discordgo.Session, channelID snowflake) (*discordgo.Webhook, error) {
+	mirrorMutex.Lock()
+	defer mirrorMutex.Unlock()
+
+	if webhook, cached := mirrorWebhooks[channelID]; cached {
+		return webhook, nil
+	}
+
+	webhooks, err := discord.ChannelWebhooks(channelID)
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range webhooks {
+		if webhook.User != nil && webhook.User.ID == discord.State.User.ID && webhook.Name == mirrorWebhookName && webhook.Token != "" {
+			mirrorWebhooks[channelID] = webhook
+			return webhook, nil
+		}
+	}
+
+	webhook, err := discord.WebhookCreate(channelID, mirrorWebhookName, "")
+	if err != nil {
+		return nil, err
+	}
+	mirrorWebhooks[channelID] = webhook
+
+	return webhook, nil
+}
+
+// isMirrorWebhook checks whether the webhook is one of ours, so we don't mirror our own copies back
+func isMirrorWebhook(webhookID snowflake) bool {
+	if webhookID == "" {
+		return false
+	}
+
+	mirrorMutex.Lock()
+	defer mirrorMutex.Unlock()
+
+	for _, webhook := range mirrorWebhooks {
+		if webhook.ID == webhookID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rememberMirror stores the copies of a message, forgetting the oldest mirrored messages if needed
+func rememberMirror(messageID snowflake, copies []*mirroredMessage) {
+	if len(copies) == 0 {
+		return
+	}
+
+	mirrorMutex.Lock()
+	defer mirrorMutex.Unlock()
+
+	mirroredMessages[messageID] = copies
+	mirroredOrder = append(mirroredOrder, messageID)
+	if len(mirroredOrder) > maxMirroredMessages {
+		delete(mirroredMessages, mirroredOrder[0])
+		mirroredOrder = mirroredOrder[1:]
+	}
+}
+
+// downloadAttachment fetches the contents of an attachment
+func downloadAttachment(url string) ([]byte, error) {
+	response, err := attachmentClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+
+	return io.ReadAll(response.Body)
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// errUsage indicates that the given arguments don't match the argument schema of the command
+var errUsage = errors.New("invalid command usage")
+
+// userError is an error with a message that is meant to be shown to the user that invoked a command
+type userError string
+
+func (e userError) Error() string {
+	return string(e)
+}
+
+// tokenize splits a command into its arguments. Arguments are separated by any amount of whitespace, and can be
+// wrapped in double quotes (straight or curly) to include whitespace in a single argument.
+func tokenize(content string) []string {
+	var (
+		tokens  []string
+		current strings.Builder
+		quoted  bool
+		started bool // Used to keep empty quoted arguments ("")
+	)
+
+	for _, r := range content {
+		switch {
+		case r == '"' || r == '“' || r == '”':
+			quoted = !quoted
+			started = true
+		case unicode.IsSpace(r) && !quoted:
+			if started {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				started = false
+			}
+		default:
+			current.WriteRune(r)
+			started = true
+		}
+	}
+
+	if started {
+		tokens = append(tokens, current.String())
+	}
+
+	return tokens
+}
+
+// mapArguments assigns positional tokens to the arguments of a command. Flags can be given anywhere.
+func mapArguments(cmd *command, tokens []string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	var positional []argument
+	for _, arg := range cmd.arguments {
+		if arg.typ != argumentFlag {
+			positional = append(positional, arg)
+		}
+	}
+
+	// Take out the flags first
+	var remaining []string
+	for _, token := range tokens {
+		if !strings.HasPrefix(token, "--") {
+			remaining = append(remaining, token)
+			continue
+		}
+
+		found := false
+		for _, arg := range cmd.arguments {
+			if arg.typ == argumentFlag && strings.EqualFold(token[2:], arg.name) {
+				values[arg.name] = "true"
+				found = true
+			}
+		}
+		if !found {
+			return nil, errUsage
+		}
+	}
+
+	// The last argument can take all remaining words
+	if n := len(positional); n != 0 && positional[n-1].rest && len(remaining) > n {
+		remaining = append(remaining[:n-1], strings.Join(remaining[n-1:], " "))
+	}
+
+	// An optional argument can be left out when the last value matches the argument after it, so "1d" isn't mistaken
+	// for a voice channel
+	if k := len(remaining) - 1; k >= 0 && k+1 < len(positional) && positional[k].optional {
+		if next := positional[k+1]; next.match != nil && next.match(remaining[k]) {
+			values[next.name] = remaining[k]
+			remaining = remaining[:k]
+		}
+	}
+
+	required := 0
+	for _, arg := range positional {
+		if !arg.optional {
+			required++
+		}
+	}
+
+	if len(remaining) < required || len(remaining) > len(positional) {
+		return nil, errUsage
+	}
+
+	for i, token := range remaining {
+		values[positional[i].name] = token
+	}
+
+	return values, nil
+}
+
+// setArguments validates the given argument values against the argument schema of the command, and resolves any
+// channel arguments. Returns errUsage if the values don't fit the schema, or a user friendly error otherwise.
+func (ctx *commandContext) setArguments(values map[string]string) error {
+	ctx.args = make(map[string]string)
+	ctx.channels = make(map[string]*discordgo.Channel)
+	ctx.roles = make(map[string]*discordgo.Role)
+	ctx.members = make(map[string]*discordgo.Member)
+
+	for _, arg := range ctx.command.arguments {
+		value, provided := values[arg.name]
+		if !provided || value == "" {
+			if !arg.optional && arg.typ != argumentFlag {
+				return errUsage
+			}
+			continue
+		}
+
+		if len(arg.choices) != 0 {
+			value = strings.ToLower(value)
+			if !containsString(arg.choices, value) {
+				return errUsage
+			}
+		}
+
+		switch arg.typ {
+		case argumentVoiceChannel, argumentTextChannel, argumentCategory:
+			channelType := discordgo.ChannelTypeGuildVoice
+			switch arg.typ {
+			case argumentTextChannel:
+				channelType = discordgo.ChannelTypeGuildText
+			case argumentCategory:
+				channelType = discordgo.ChannelTypeGuildCategory
+			}
+
+			channel, err := resolveChannel(ctx.discord, ctx.guildID, value, channelType)
+			if err != nil {
+				return err
+			}
+
+			ctx.channels[arg.name] = channel
+			value = channel.ID
+		case argumentRole, argumentMentionable:
+			role, err := resolveRole(ctx.discord, ctx.guildID, value)
+			if err == nil {
+				ctx.roles[arg.name] = role
+				value = role.ID
+				break
+			}
+			if arg.typ == argumentRole {
+				return err
+			}
+			fallthrough
+		case argumentUser:
+			member, err := resolveMember(ctx.discord, ctx.guildID, value)
+			if err != nil {
+				if arg.typ == argumentMentionable {
+					return userError("I'm sorry, I could not find a role or member matching \"" + value + "\".")
+				}
+				return err
+			}
+
+			ctx.members[arg.name] = member
+			value = member.User.ID
+		}
+
+		ctx.args[arg.name] = value
+	}
+
+	return nil
+}
+
+// resolveChannel finds a channel of the given type in the guild by its ID, mention or name.
+// Names are matched case-insensitively, if several channels share the same name the error lists all of them so the
+// user can pick one by its ID.
+func resolveChannel(discord *discordgo.Session, guildID snowflake, value string, channelType discordgo.ChannelType) (*discordgo.Channel, error) {
+	typeName := channelTypeName(channelType)
+
+	// Channel mentions and raw IDs
+	id := value
+	if strings.HasPrefix(id, "<#") && strings.HasSuffix(id, ">") {
+		id = id[2 : len(id)-1]
+	}
+	if isSnowflake(id) {
+		channel, err := getChannel(discord, id)
+		if err != nil || channel.GuildID != guildID {
+			return nil, userError(fmt.Sprintf("I'm sorry, I could not find a %s channel with the ID %s in this server.", typeName, id))
+		}
+		if channel.Type != channelType {
+			return nil, userError(fmt.Sprintf("%s is not a %s channel.", channel.Name, typeName))
+		}
+
+		return channel, nil
+	}
+
+	// Channel names
+	guild, err := getGuild(discord, guildID)
+	if err != nil {
+		return nil, userError("I'm sorry, I could not look up the channels of this server.")
+	}
+
+	name := strings.TrimPrefix(value, "#")
+	// Text channel names can't contain spaces, Discord replaces them with dashes
+	dashed := strings.Replace(name, " ", "-", -1)
+	var matches []*discordgo.Channel
+	for _, channel := range guild.Channels {
+		if channel.Type == channelType && (strings.EqualFold(channel.Name, name) || strings.EqualFold(channel.Name, dashed)) {
+			matches = append(matches, channel)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, userError(fmt.Sprintf("I'm sorry, I could not find a %s channel named \"%s\".", typeName, name))
+	case 1:
+		return matches[0], nil
+	}
+
+	message := fmt.Sprintf("There are several %s channels named \"%s\", please use the ID of the one you mean:", typeName, name)
+	for _, channel := range matches {
+		message += "\n• " + channel.ID
+		if channel.ParentID == "" {
+			continue
+		}
+		if parent, err := getChannel(discord, channel.ParentID); err == nil {
+			message += " in category " + parent.Name
+		}
+	}
+
+	return nil, userError(message)
+}
+
+// resolveRole finds a role in the guild by its ID, mention or name (case-insensitive).
+func resolveRole(discord *discordgo.Session, guildID snowflake, value string) (*discordgo.Role, error) {
+	id := value
+	if strings.HasPrefix(id, "<@&") && strings.HasSuffix(id, ">") {
+		id = id[3 : len(id)-1]
+	}
+	if isSnowflake(id) {
+		role, err := getRole(discord, guildID, id)
+		if err != nil {
+			return nil, userError("I'm sorry, I could not find a role with the ID " + id + " in this server.")
+		}
+
+		return role, nil
+	}
+
+	guild, err := getGuild(discord, guildID)
+	if err != nil {
+		return nil, userError("I'm sorry, I could not look up the roles of this server.")
+	}
+
+	name := strings.TrimPrefix(value, "@")
+	var matches []*discordgo.Role
+	for _, role := range guild.Roles {
+		if strings.EqualFold(role.Name, name) {
+			matches = append(matches, role)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, userError(fmt.Sprintf("I'm sorry, I could not find a role named \"%s\".", name))
+	case 1:
+		return matches[0], nil
+	}
+
+	message := fmt.Sprintf("There are several roles named \"%s\", please use the ID of the one you mean:", name)
+	for _, role := range matches {
+		message += "\n• " + role.ID
+	}
+
+	return nil, userError(message)
+}
+
+// resolveMember finds a member of the guild by their ID, mention, username or nickname (case-insensitive).
+func resolveMember(discord *discordgo.Session, guildID snowflake, value string) (*discordgo.Member, error) {
+	id := strings.TrimPrefix(value, "<@")
+	id = strings.TrimPrefix(id, "!")
+	id = strings.TrimSuffix(id, ">")
+	if isSnowflake(id) {
+		member, err := getGuildMember(discord, guildID, id)
+		if err != nil {
+			return nil, userError("I'm sorry, I could not find a member with the ID " + id + " in this server.")
+		}
+
+		return member, nil
+	}
+
+	// Our member cache is not necessarily complete, so ask Discord
+	name := strings.TrimPrefix(value, "@")
+	members, err := discord.GuildMembersSearch(guildID, name, 10)
+	if err != nil {
+		return nil, userError("I'm sorry, I could not look up the members of this server.")
+	}
+
+	var matches []*discordgo.Member
+	for _, member := range members {
+		if strings.EqualFold(member.User.Username, name) || strings.EqualFold(member.User.GlobalName, name) ||
+			strings.EqualFold(member.Nick, name) {
+			matches = append(matches, member)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, userError(fmt.Sprintf("I'm sorry, I could not find a member named \"%s\".", name))
+	case 1:
+		return matches[0], nil
+	}
+
+	message := fmt.Sprintf("There are several members named \"%s\", please use the ID or a mention of the one you mean:", name)
+	for _, member := range matches {
+		message += "\n• " + member.User.ID + " (" + member.User.Username + ")"
+	}
+
+	return nil, userError(message)
+}
+
+// parseDuration parses durations like "90s", "15m", "2h", "7d" or "1w", or combinations like "1h30m".
+func parseDuration(value string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		's': time.Second,
+		'm': time.Minute,
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+	}
+
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return 0, userError("Please provide a duration, like 30m, 2h or 7d.")
+	}
+
+	var total time.Duration
+	for value != "" {
+		i := 0
+		for i < len(value) && value[i] >= '0' && value[i] <= '9' {
+			i++
+		}
+
+		amount, err := strconv.Atoi(value[:i])
+		if err != nil || i == len(value) {
+			return 0, userError("\"" + value + "\" is not a valid duration, use something like 30m, 2h or 7d.")
+		}
+
+		unit, known := units[value[i]]
+		if !known {
+			return 0, userError("\"" + value + "\" is not a valid duration, use something like 30m, 2h or 7d.")
+		}
+
+		// Durations larger than about 290 years don't fit
+		if time.Duration(amount) > (math.MaxInt64-total)/unit {
+			return 0, userError("\"" + value + "\" is too long a duration.")
+		}
+
+		total += time.Duration(amount) * unit
+		value = value[i+1:]
+	}
+
+	if total <= 0 {
+		return 0, userError("The duration needs to be longer than zero.")
+	}
+
+	return total, nil
+}
+
+// isDuration checks whether the value is a duration parseDuration accepts, used to match duration arguments
+func isDuration(value string) bool {
+	_, err := parseDuration(value)
+	return err == nil
+}
+
+// formatDuration formats a duration the way parseDuration accepts it, e.g. "1d2h" or "15m"
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return strconv.Itoa(int(d/time.Second)) + "s"
+	}
+
+	var formatted string
+	for _, unit := range []struct {
+		suffix string
+		length time.Duration
+	}{{"d", 24 * time.Hour}, {"h", time.Hour}, {"m", time.Minute}} {
+		if d >= unit.length {
+			formatted += strconv.Itoa(int(d/unit.length)) + unit.suffix
+			d %= unit.length
+		}
+	}
+
+	return formatted
+}
+
+// containsString checks whether the given value is in the list
+func containsString(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSnowflake checks whether the given value looks like a Discord ID
+func isSnowflake(value string) bool {
+	if len(value) < 15 || len(value) > 20 {
+		return false
+	}
+
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// channelTypeName returns the name we use for channel types in messages to users
+func channelTypeName(channelType discordgo.ChannelType) string {
+	switch channelType {
+	case discordgo.ChannelTypeGuildVoice:
+		return "voice"
+	case discordgo.ChannelTypeGuildText:
+		return "text"
+	case discordgo.ChannelTypeGuildCategory:
+		return "category"
+	default:
+		return "matching"
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"empty", "", nil},
+		{"only whitespace", "  \t\n ", nil},
+		{"single word", "voicelink", []string{"voicelink"}},
+		{"repeated whitespace", "voicelink  \"Squad 1\"\t \n#squad-1", []string{"voicelink", "Squad 1", "#squad-1"}},
+		{"leading and trailing whitespace", "  voicelink squad  ", []string{"voicelink", "squad"}},
+		{"straight quotes", `voicelink "Squad 1" squad-1`, []string{"voicelink", "Squad 1", "squad-1"}},
+		{"curly quotes", "voicelink “Squad 1” squad-1", []string{"voicelink", "Squad 1", "squad-1"}},
+		{"mixed quotes", "voicelink “Squad 1\" squad-1", []string{"voicelink", "Squad 1", "squad-1"}},
+		{"empty quotes", `voicelinkset "Squad 1" grace ""`, []string{"voicelinkset", "Squad 1", "grace", ""}},
+		{"quotes inside a word", `say"hello world"s`, []string{"sayhello worlds"}},
+		{"unterminated quote", `voicelink "Squad 1`, []string{"voicelink", "Squad 1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := tokenize(test.content); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("tokenize(%q) = %q, want %q", test.content, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMapArguments(t *testing.T) {
+	link := &command{
+		name: "voicelink",
+		arguments: []argument{
+			{name: "voice", typ: argumentVoiceChannel},
+			{name: "text", typ: argumentTextChannel, optional: true},
+			{name: "force", typ: argumentFlag},
+		},
+	}
+	set := &command{
+		name: "voicelinkset",
+		arguments: []argument{
+			{name: "voice", typ: argumentVoiceChannel},
+			{name: "option", typ: argumentString, optional: true},
+			{name: "value", typ: argumentString, optional: true, rest: true},
+		},
+	}
+	block := &command{
+		name: "voicelinkblock",
+		arguments: []argument{
+			{name: "user", typ: argumentUser},
+			{name: "voice", typ: argumentVoiceChannel, optional: true},
+			{name: "duration", typ: argumentString, optional: true, match: isDuration},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		cmd     *command
+		tokens  []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"required only", link, []string{"Squad 1"}, map[string]string{"voice": "Squad 1"}, false},
+		{"optional given", link, []string{"Squad 1", "squad-1"}, map[string]string{"voice": "Squad 1", "text": "squad-1"}, false},
+		{"flag last", link, []string{"Squad 1", "--force"}, map[string]string{"voice": "Squad 1", "force": "true"}, false},
+		{"flag first", link, []string{"--force", "Squad 1"}, map[string]string{"voice": "Squad 1", "force": "true"}, false},
+		{"flag case insensitive", link, []string{"Squad 1", "--FORCE"}, map[string]string{"voice": "Squad 1", "force": "true"}, false},
+		{"unknown flag", link, []string{"Squad 1", "--quiet"}, nil, true},
+		{"missing required", link, nil, nil, true},
+		{"only a flag", link, []string{"--force"}, nil, true},
+		{"too many", link, []string{"Squad 1", "squad-1", "extra"}, nil, true},
+		{"rest joined", set, []string{"Squad 1", "spectators", "@Mods", "@Admins"}, map[string]string{"voice": "Squad 1", "option": "spectators", "value": "@Mods @Admins"}, false},
+		{"rest single", set, []string{"Squad 1", "grace", "10m"}, map[string]string{"voice": "Squad 1", "option": "grace", "value": "10m"}, false},
+		{"rest left out", set, []string{"Squad 1"}, map[string]string{"voice": "Squad 1"}, false},
+		{"duration after voice", block, []string{"@Troll", "Squad 1", "1d"}, map[string]string{"user": "@Troll", "voice": "Squad 1", "duration": "1d"}, false},
+		{"duration without voice", block, []string{"@Troll", "1d"}, map[string]string{"user": "@Troll", "duration": "1d"}, false},
+		{"voice without duration", block, []string{"@Troll", "Squad 1"}, map[string]string{"user": "@Troll", "voice": "Squad 1"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := mapArguments(test.cmd, test.tokens)
+			if test.wantErr {
+				if err != errUsage {
+					t.Errorf("mapArguments(%q) error = %v, want errUsage", test.tokens, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mapArguments(%q) unexpected error: %v", test.tokens, err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("mapArguments(%q) = %v, want %v", test.tokens, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30s", 30 * time.Second, false},
+		{"15m", 15 * time.Minute, false},
+		{"2h", 2 * time.Hour, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"1w", 7 * 24 * time.Hour, false},
+		{"1d12h", 36 * time.Hour, false},
+		{" 1H30M ", 90 * time.Minute, false},
+		{"", 0, true},
+		{"10", 0, true},
+		{"m", 0, true},
+		{"5y", 0, true},
+		{"1h-5m", 0, true},
+		{"0m", 0, true},
+		{"0d0h", 0, true},
+		{"15250w", 15250 * 7 * 24 * time.Hour, false},
+		{"15251w", 0, true},
+		{"106751d23h47m16s854775807s", 0, true},
+		{"99999999999999999999d", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := parseDuration(test.value)
+			if test.wantErr {
+				if _, isUserError := err.(userError); !isUserError {
+					t.Errorf("parseDuration(%q) error = %v, want a userError", test.value, err)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("parseDuration(%q) = %v, %v, want %v", test.value, got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for _, d := range []time.Duration{45 * time.Second, 15 * time.Minute, 90 * time.Minute, 36 * time.Hour, 7*24*time.Hour + time.Minute} {
+		formatted := formatDuration(d)
+		if parsed, err := parseDuration(formatted); err != nil || parsed != d {
+			t.Errorf("parseDuration(formatDuration(%v)) = %v, %v via %q", d, parsed, err, formatted)
+		}
+	}
+}
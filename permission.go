@@ -0,0 +1,181 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// permissionLevel describes who is allowed to invoke a command
+type permissionLevel int
+
+const (
+	// permissionEveryone allows anyone to use the command
+	permissionEveryone permissionLevel = iota
+	// permissionManager allows link managers to use the command, see checkPermission
+	permissionManager
+	// permissionAdmin allows members with the Administrator or Manage Server permission to use the command
+	permissionAdmin
+)
+
+// description returns a human readable description of who may use commands of this level
+func (level permissionLevel) description() string {
+	switch level {
+	case permissionManager:
+		return "the Manage Channels permission or to be a link manager"
+	case permissionAdmin:
+		return "the Manage Server permission"
+	default:
+		return "no special permissions"
+	}
+}
+
+// defaultMemberPermissions returns the permissions Discord should require for the slash command variant by default.
+// Link managers do not necessarily have any specific permission, so those commands are visible to everyone and we
+// check the permissions ourselves.
+func (level permissionLevel) defaultMemberPermissions() *int64 {
+	if level != permissionAdmin {
+		return nil
+	}
+
+	permission := int64(discordgo.PermissionManageServer)
+	return &permission
+}
+
+// isAdmin checks whether the given server-wide permissions allow managing the bot's guild settings
+func isAdmin(permissions int64) bool {
+	return hasPermission(permissions, discordgo.PermissionAdministrator) || hasPermission(permissions, discordgo.PermissionManageServer)
+}
+
+// isLinkManager checks whether the member has been granted link management rights, either directly or through one of
+// their roles. The caller is expected to hold a read lock on configMutex.
+func isLinkManager(guildID snowflake, member *discordgo.Member) bool {
+	settings, exists := config.Settings[guildID]
+	if !exists || member == nil {
+		return false
+	}
+
+	if containsSnowflake(settings.ManagerUsers, member.User.ID) {
+		return true
+	}
+
+	for _, roleID := range member.Roles {
+		if containsSnowflake(settings.ManagerRoles, roleID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mayUse checks whether the invoking user might be able to use the command, without taking its arguments into
+// account. Used to filter the help output.
+func (ctx *commandContext) mayUse(cmd *command) bool {
+	switch cmd.permission {
+	case permissionManager:
+		configMutex.RLock()
+		defer configMutex.RUnlock()
+
+		settings, exists := config.Settings[ctx.guildID]
+		return isAdmin(ctx.permissions) || hasPermission(ctx.permissions, discordgo.PermissionManageChannels) ||
+			isLinkManager(ctx.guildID, ctx.member) || (exists && settings.RequireChannelPermission)
+	case permissionAdmin:
+		return isAdmin(ctx.permissions)
+	default:
+		return true
+	}
+}
+
+// checkPermission is the central permission check for all commands, it is called after the arguments are resolved.
+// Link management commands can be used by:
+//   - Administrators and members with the Manage Server permission
+//   - Members that are link managers through one of their roles or a personal grant
+//   - Members with the Manage Channels permission. If the guild requires channel permissions, this permission is checked
+//     on every channel the command is invoked with, and the text channels linked to them, rather than server-wide.
+func (ctx *commandContext) checkPermission() error {
+	switch ctx.command.permission {
+	case permissionEveryone:
+		return nil
+	case permissionAdmin:
+		if isAdmin(ctx.permissions) {
+			return nil
+		}
+	case permissionManager:
+		if isAdmin(ctx.permissions) {
+			return nil
+		}
+
+		configMutex.RLock()
+		manager := isLinkManager(ctx.guildID, ctx.member)
+		settings, exists := config.Settings[ctx.guildID]
+		channelMode := exists && settings.RequireChannelPermission
+		// Commands acting on an existing link change its text channel as well
+		var textIDs []snowflake
+		for _, channel := range ctx.channels {
+			if link, linked := config.Guilds[ctx.guildID][channel.ID]; linked && link.TextChannelID != "" {
+				textIDs = append(textIDs, link.TextChannelID)
+			}
+		}
+		configMutex.RUnlock()
+
+		if manager {
+			return nil
+		}
+
+		if !channelMode || len(ctx.channels) == 0 {
+			if hasPermission(ctx.permissions, discordgo.PermissionManageChannels) {
+				return nil
+			}
+			break
+		}
+
+		// Every channel involved needs to be manageable by the user
+		channels := make([]*discordgo.Channel, 0, len(ctx.channels)+len(textIDs))
+		for _, channel := range ctx.channels {
+			channels = append(channels, channel)
+		}
+		for _, textID := range textIDs {
+			text, err := getChannel(ctx.discord, textID)
+			if err != nil {
+				continue // The text channel is gone, so there is nothing to protect
+			}
+			channels = append(channels, text)
+		}
+		for _, channel := range channels {
+			permissions, err := computeOverwrites(ctx.permissions, ctx.member, channel)
+			if err != nil || !hasPermission(permissions, discordgo.PermissionManageChannels) {
+				return userError("You need the Manage Channels permission on " + channel.Mention() + " to use this command.")
+			}
+		}
+
+		return nil
+	}
+
+	return userError("You need " + ctx.command.permission.description() + " to use this command.")
+}
+
+// hasPermission checks whether the given permission set contains the required permission
+func hasPermission(permissions, required int64) bool {
+	return permissions&required == required
+}
+
+// containsSnowflake checks whether the given ID is in the list
+func containsSnowflake(list []snowflake, id snowflake) bool {
+	for _, entry := range list {
+		if entry == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeSnowflake returns the list without the given ID
+func removeSnowflake(list []snowflake, id snowflake) []snowflake {
+	filtered := list[:0]
+	for _, entry := range list {
+		if entry != id {
+			filtered = append(filtered, entry)
+		}
+	}
+
+	return filtered
+}
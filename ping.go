@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	pingVoice    = "voice"
+	pingEveryone = "everyone"
+	pingManagers = "managers"
+	pingOff      = "off"
+
+	// pingCooldown is how long members have to wait before pinging the same voice channels again, managers are exempt
+	pingCooldown = time.Minute
+	// maxPingedMembers is the amount of users Discord allows to be mentioned in a single message
+	maxPingedMembers = 100
+)
+
+// pingKeyword matches @voice as a separate word
+var pingKeyword = regexp.MustCompile(`(?i)(^|\s)@voice\b`)
+
+var (
+	pingMutex sync.Mutex
+	// lastPings contains when each text channel last pinged voice
+	lastPings = make(map[snowflake]time.Time)
+)
+
+func init() {
+	registerCommand(&command{
+		name:    "voiceping",
+		aliases: []string{"voiceall"},
+		arguments: []argument{
+			{name: "message", description: "What to tell everyone in voice.", typ: argumentString, optional: true, rest: true},
+		},
+		permission: permissionEveryone,
+		help:       "Mentions everyone in the voice channels linked to this text channel.",
+		handler:    pingCommand,
+	})
+
+	registerLinkOption(&linkOption{
+		name:        "ping",
+		description: "Who may ping everyone in voice from the text channel: `voice` (members in voice), `everyone`, `managers` or `off`.",
+		set: func(_ *commandContext, link *voiceLink, value string) error {
+			switch strings.ToLower(value) {
+			case "", pingVoice:
+				link.Ping = ""
+			case pingEveryone, pingManagers, pingOff:
+				link.Ping = strings.ToLower(value)
+			default:
+				return userError("Please use `voice`, `everyone`, `managers` or `off`.")
+			}
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			return link.Ping
+		},
+	})
+
+	registerLinkOption(switchOption("pingkeyword", "`on` to also ping everyone in voice when someone writes @voice in the text channel.", func(link *voiceLink) *bool { return &link.PingKeyword }))
+
+	discord.AddHandler(onPingKeyword)
+}
+
+func pingCommand(ctx *commandContext) {
+	pinged, err := pingVoiceMembers(ctx.discord, ctx.guildID, ctx.channelID, ctx.member, ctx.permissions, false, &discordgo.MessageSend{
+		Content: "📢 **" + ctx.member.DisplayName() + "** pings everyone in voice: " + ctx.arg("message"),
+	})
+	if err != nil {
+		ctx.respondError(err)
+		return
+	}
+
+	ctx.respond(fmt.Sprintf("Done! I've pinged %d members in voice.", pinged))
+}
+
+// onPingKeyword pings everyone in voice when @voice is used in a linked text channel that has the keyword enabled
+func onPingKeyword(discord *discordgo.Session, event *discordgo.MessageCreate) {
+	if event.Author == nil || event.Author.Bot || event.GuildID == "" || !pingKeyword.MatchString(event.Content) {
+		return
+	}
+
+	// Commands are handled by the command itself
+	if _, isCommand := stripCommandPrefix(discord, event.GuildID, event.Content); isCommand {
+		return
+	}
+
+	member, err := getGuildMember(discord, event.GuildID, event.Author.ID)
+	if err != nil {
+		log.Println("Could not fetch guild member", err)
+		return
+	}
+	permissions, _ := getPermissionsFromMessage(discord, event)
+
+	_, err = pingVoiceMembers(discord, event.GuildID, event.ChannelID, member, permissions, true, &discordgo.MessageSend{
+		Content:   "📢",
+		Reference: event.Reference(),
+	})
+	if err != nil {
+		// Let the user know why nothing happened, without pinging anyone
+		_, err = discord.ChannelMessageSendComplex(event.ChannelID, &discordgo.MessageSend{
+			Content:         err.Error(),
+			Reference:       event.Reference(),
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err != nil {
+			log.Println("Could not send ping response.", err)
+		}
+	}
+}
+
+// pingVoiceMembers mentions everyone in the voice channels linked to the text channel, appending the mentions to the
+// given message. Only links that allow the member to ping are included, and for the keyword only those that have it
+// enabled. Returns how many members were pinged.
+func pingVoiceMembers(discord *discordgo.Session, guildID, channelID snowflake, member *discordgo.Member, permissions int64, keyword bool, message *discordgo.MessageSend) (int, error) {
+	guild, err := getGuild(discord, guildID)
+	if err != nil {
+		return 0, userError("I'm sorry, I could not look up the voice states of this server.")
+	}
+
+	configMutex.RLock()
+	manager := isAdmin(permissions) || hasPermission(permissions, discordgo.PermissionManageChannels) || isLinkManager(guildID, member)
+	linked, allowed := false, false
+	var voiceIDs []snowflake
+	for voiceID, link := range config.Guilds[guildID] {
+		if link.TextChannelID != channelID || (keyword && !link.PingKeyword) {
+			continue
+		}
+		linked = true
+
+		switch link.Ping {
+		case pingOff:
+			continue
+		case pingManagers:
+			allowed = manager
+		case pingEveryone:
+			allowed = true
+		default:
+			allowed = manager || voiceChannelOf(guild, member.User.ID) == voiceID
+		}
+		if allowed {
+			voiceIDs = append(voiceIDs, voiceID)
+		}
+	}
+	configMutex.RUnlock()
+
+	switch {
+	case !linked && keyword:
+		return 0, nil // Just someone writing @voice
+	case !linked:
+		return 0, userError("This channel is not linked to a voice channel.")
+	case len(voiceIDs) == 0:
+		return 0, userError("You're not allowed to ping voice from this channel.")
+	}
+
+	var mentions []string
+	var users []string
+	for _, state := range guild.VoiceStates {
+		if state.UserID == member.User.ID || !containsSnowflake(voiceIDs, state.ChannelID) || len(users) == maxPingedMembers {
+			continue
+		}
+		mentions = append(mentions, "<@"+state.UserID+">")
+		users = append(users, state.UserID)
+	}
+	if len(users) == 0 {
+		return 0, userError("Nobody else is in voice right now.")
+	}
+
+	pingMutex.Lock()
+	if last, pinged := lastPings[channelID]; pinged && !manager && time.Since(last) < pingCooldown {
+		pingMutex.Unlock()
+		return 0, userError(fmt.Sprintf("Voice has been pinged <t:%d:R>, please wait a bit before pinging again.", last.Unix()))
+	}
+	lastPings[channelID] = time.Now()
+	pingMutex.Unlock()
+
+	message.Content = truncate(message.Content+"\n"+strings.Join(mentions, " "), 2000)
+	message.AllowedMentions = &discordgo.MessageAllowedMentions{Users: users}
+	if _, err = discord.ChannelMessageSendComplex(channelID, message); err != nil {
+		log.Println("Could not ping voice.", err)
+		return 0, userError("I'm sorry, I could not send the ping. Make sure I can send messages in this channel.")
+	}
+
+	log.Printf("User %s has pinged %d members in voice from channel %s.\n", member.User.String(), len(users), channelID)
+	return len(users), nil
+}
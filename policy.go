@@ -0,0 +1,145 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// accessLevel is the access a member in voice gets to the linked text channel
+type accessLevel int
+
+const (
+	accessNone accessLevel = iota
+	accessRead
+	accessFull
+)
+
+// readOnlyDeny contains the permissions denied to members that may only read the text channel
+const readOnlyDeny = discordgo.PermissionSendMessages | discordgo.PermissionSendMessagesInThreads | discordgo.PermissionAddReactions
+
+// accessNames maps the names used in the policy option to access levels
+var accessNames = map[string]accessLevel{
+	"none": accessNone,
+	"read": accessRead,
+	"full": accessFull,
+}
+
+// voiceConditions contains the voice states a link can have a policy for, along with the access they get by default.
+// Deafened members can't follow the conversation, so they lose access unless the link says otherwise.
+var voiceConditions = map[string]struct {
+	applies  func(state *discordgo.VoiceState) bool
+	fallback accessLevel
+}{
+	"selfdeaf": {func(state *discordgo.VoiceState) bool { return state.SelfDeaf }, accessNone},
+	"deaf":     {func(state *discordgo.VoiceState) bool { return state.Deaf }, accessNone},
+	"selfmute": {func(state *discordgo.VoiceState) bool { return state.SelfMute }, accessFull},
+	"mute":     {func(state *discordgo.VoiceState) bool { return state.Mute }, accessFull},
+	"suppress": {func(state *discordgo.VoiceState) bool { return state.Suppress }, accessFull},
+}
+
+func init() {
+	registerLinkOption(&linkOption{
+		name:        "policy",
+		description: "The access members get while muted or deafened, like `mute read`: `selfdeaf`, `deaf`, `selfmute`, `mute` or `suppress`, followed by `full`, `read` or `none`. Leave out the access to reset it.",
+		set:         setPolicyOption,
+		show: func(link *voiceLink) string {
+			var conditions []string
+			for condition, access := range link.Policy {
+				conditions = append(conditions, condition+" "+access)
+			}
+			sort.Strings(conditions)
+			return strings.Join(conditions, ", ")
+		},
+		changed: refreshGuild,
+	})
+}
+
+// setPolicyOption changes the access for a single condition, or resets the whole policy without a value
+func setPolicyOption(_ *commandContext, link *voiceLink, value string) error {
+	fields := strings.Fields(strings.ToLower(value))
+	if len(fields) == 0 {
+		link.Policy = nil
+		return nil
+	}
+
+	condition, known := voiceConditions[fields[0]]
+	if !known || len(fields) > 2 {
+		return userError("Please use `selfdeaf`, `deaf`, `selfmute`, `mute` or `suppress`, followed by `full`, `read` or `none`.")
+	}
+
+	level, valid := accessNames[fields[len(fields)-1]]
+	if len(fields) == 2 && !valid {
+		return userError("Please use `full`, `read` or `none`.")
+	}
+
+	// Without an access level, or with the default one, the condition is reset
+	if len(fields) == 1 || level == condition.fallback {
+		delete(link.Policy, fields[0])
+		if len(link.Policy) == 0 {
+			link.Policy = nil
+		}
+		return nil
+	}
+
+	if link.Policy == nil {
+		link.Policy = make(map[string]string)
+	}
+	link.Policy[fields[0]] = fields[1]
+
+	return nil
+}
+
+// accessFor decides what access the member with the given voice state should have to the text channel linked to the
+// given voice channel. If several conditions apply, like being muted and deafened, the most restrictive one wins.
+func (link *voiceLink) accessFor(voiceID snowflake, state *discordgo.VoiceState) accessLevel {
+	if state.ChannelID == "" || state.ChannelID != voiceID {
+		return accessNone
+	}
+
+	access := accessFull
+	for name, condition := range voiceConditions {
+		if !condition.applies(state) {
+			continue
+		}
+
+		level := condition.fallback
+		if configured, exists := link.Policy[name]; exists {
+			level = accessNames[configured]
+		}
+		if level < access {
+			access = level
+		}
+	}
+
+	return access
+}
+
+// allowsDeafened checks whether the policy of the link says what access deafened members get, for every way the member
+// is deafened. Those members are meant to stay in voice rather than being moved to the AFK channel.
+func (link *voiceLink) allowsDeafened(state *discordgo.VoiceState) bool {
+	for _, name := range []string{"selfdeaf", "deaf"} {
+		if _, configured := link.Policy[name]; voiceConditions[name].applies(state) && !configured {
+			return false
+		}
+	}
+
+	return true
+}
+
+// overwriteAccess returns the access given by an overwrite we created, or false if we did not create it
+func overwriteAccess(overwrite *discordgo.PermissionOverwrite) (accessLevel, bool) {
+	if overwrite.Type != discordgo.PermissionOverwriteTypeMember || overwrite.Allow != discordgo.PermissionViewChannel {
+		return accessNone, false
+	}
+
+	switch overwrite.Deny {
+	case 0:
+		return accessFull, true
+	case readOnlyDeny:
+		return accessRead, true
+	}
+
+	return accessNone, false
+}
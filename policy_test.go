@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestAccessFor(t *testing.T) {
+	const voiceID = "100"
+
+	tests := []struct {
+		name   string
+		policy map[string]string
+		state  discordgo.VoiceState
+		want   accessLevel
+	}{
+		{"not in voice", nil, discordgo.VoiceState{}, accessNone},
+		{"other voice channel", nil, discordgo.VoiceState{ChannelID: "200"}, accessNone},
+		{"in voice", nil, discordgo.VoiceState{ChannelID: voiceID}, accessFull},
+		{"self muted by default", nil, discordgo.VoiceState{ChannelID: voiceID, SelfMute: true}, accessFull},
+		{"self deafened by default", nil, discordgo.VoiceState{ChannelID: voiceID, SelfMute: true, SelfDeaf: true}, accessNone},
+		{"server deafened by default", nil, discordgo.VoiceState{ChannelID: voiceID, Deaf: true}, accessNone},
+		{"muted read only", map[string]string{"mute": "read"}, discordgo.VoiceState{ChannelID: voiceID, Mute: true}, accessRead},
+		{"policy of another condition", map[string]string{"mute": "read"}, discordgo.VoiceState{ChannelID: voiceID, SelfMute: true}, accessFull},
+		{"self deafened allowed", map[string]string{"selfdeaf": "full"}, discordgo.VoiceState{ChannelID: voiceID, SelfDeaf: true}, accessFull},
+		{"most restrictive wins", map[string]string{"selfdeaf": "read", "selfmute": "none"}, discordgo.VoiceState{ChannelID: voiceID, SelfMute: true, SelfDeaf: true}, accessNone},
+		{"suppressed", map[string]string{"suppress": "read"}, discordgo.VoiceState{ChannelID: voiceID, Suppress: true}, accessRead},
+		{"policy out of voice", map[string]string{"selfdeaf": "full"}, discordgo.VoiceState{SelfDeaf: true}, accessNone},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			link := &voiceLink{Policy: test.policy}
+			if got := link.accessFor(voiceID, &test.state); got != test.want {
+				t.Errorf("accessFor(%+v) = %d, want %d", test.state, got, test.want)
+			}
+		})
+	}
+}
+
+func TestAllowsDeafened(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy map[string]string
+		state  discordgo.VoiceState
+		want   bool
+	}{
+		{"no policy", nil, discordgo.VoiceState{SelfDeaf: true}, false},
+		{"self deafened", map[string]string{"selfdeaf": "read"}, discordgo.VoiceState{SelfDeaf: true}, true},
+		{"deafened by a moderator", map[string]string{"selfdeaf": "full"}, discordgo.VoiceState{Deaf: true}, false},
+		{"deafened both ways", map[string]string{"selfdeaf": "full"}, discordgo.VoiceState{SelfDeaf: true, Deaf: true}, false},
+		{"both configured", map[string]string{"selfdeaf": "full", "deaf": "read"}, discordgo.VoiceState{SelfDeaf: true, Deaf: true}, true},
+		{"only muted", map[string]string{"mute": "read"}, discordgo.VoiceState{SelfDeaf: true}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			link := &voiceLink{Policy: test.policy}
+			if got := link.allowsDeafened(&test.state); got != test.want {
+				t.Errorf("allowsDeafened(%+v) = %v, want %v", test.state, got, test.want)
+			}
+		})
+	}
+}
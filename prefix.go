@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+const maxPrefixLength = 10
+
+func init() {
+	registerCommand(&command{
+		name: "voiceprefix",
+		arguments: []argument{
+			{name: "prefix", description: "The new prefix for text commands, or \"reset\" to restore the default.", typ: argumentString, optional: true},
+		},
+		permission: permissionAdmin,
+		help:       "Shows or changes the prefix used for text commands in this server. Mentioning me always works as a prefix too.",
+		handler:    prefixCommand,
+	})
+}
+
+func prefixCommand(ctx *commandContext) {
+	prefix := ctx.arg("prefix")
+
+	// Without arguments, just show the current prefix
+	if prefix == "" {
+		ctx.respond("The prefix for text commands in this server is `" + getCommandPrefix(ctx.guildID) + "`.")
+		return
+	}
+
+	if strings.ContainsAny(prefix, " \t\n`") || len([]rune(prefix)) > maxPrefixLength {
+		ctx.respond("The prefix can't contain spaces or backticks, and can't be longer than 10 characters.")
+		return
+	}
+
+	if strings.ToLower(prefix) == "reset" {
+		prefix = defaultCommandPrefix
+	}
+
+	configMutex.Lock()
+	settings := getGuildSettings(ctx.guildID)
+	settings.Prefix = prefix
+	if prefix == defaultCommandPrefix {
+		settings.Prefix = ""
+	}
+	configMutex.Unlock()
+	go saveConfig()
+
+	log.Printf("User %s has changed the command prefix of guild %s to %s\n", ctx.user.String(), ctx.guildID, prefix)
+	ctx.respond("Success! The prefix for text commands in this server is now `" + prefix + "`.")
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// channelPlan describes the member overwrites on a single linked text channel, compared to what they should be.
+// A text channel can be linked to several voice channels, so plans are made per text channel rather than per link.
+type channelPlan struct {
+	text     *discordgo.Channel
+	voiceIDs []snowflake
+	inVoice  []snowflake // Members in one of the linked voice channels
+	granted  []snowflake // Members that have an overwrite created by us
+	missing  []snowflake // Members that should have access, but have no overwrite yet or one giving the wrong access
+	stale    []snowflake // Members that have an overwrite created by us, but should no longer have access
+	manual   []snowflake // Members with an overwrite we did not create, we leave these alone
+	exempt   []snowflake // Exempt members in voice or with an overwrite, we leave these alone too
+	withheld []snowflake // Members in voice that are blocked or don't meet the requirements of the link
+	guests   []snowflake // Members with a guest pass, they have access regardless of their voice state
+
+	access     map[snowflake]accessLevel // The access each member in missing should get
+	reevaluate map[snowflake]time.Time   // When the access of members changes by itself, like when a timeout ends
+}
+
+// planOverwrites compares the member overwrites on all linked text channels of a guild to the given voice states.
+// If userID is not empty, only the overwrites of that user are considered.
+// The caller is expected to hold a read lock on configMutex.
+func planOverwrites(discord *discordgo.Session, links guildChannels, states []*discordgo.VoiceState, userID snowflake) []*channelPlan {
+	// Group the voice channels by the text channel they're linked to
+	byText := make(map[snowflake][]snowflake)
+	for voiceID, link := range links {
+		if link.TextChannelID == "" {
+			continue // Ephemeral link without a text channel at the moment
+		}
+		byText[link.TextChannelID] = append(byText[link.TextChannelID], voiceID)
+	}
+
+	var plans []*channelPlan
+	for textID, voiceIDs := range byText {
+		plan, err := planText(discord, textID, voiceIDs, states, userID)
+		if err != nil {
+			log.Println("Channel exists in config, but not in state.")
+			continue
+		}
+
+		plans = append(plans, plan)
+	}
+
+	sort.Slice(plans, func(i, j int) bool {
+		return plans[i].text.Position < plans[j].text.Position
+	})
+
+	return plans
+}
+
+// planText compares the member overwrites on a single text channel to the given voice states, for the given voice
+// channels linked to it. If no voice channels are given, all overwrites created by us are considered stale.
+// If userID is not empty, only the overwrites of that user are considered.
+// Planning has no side effects, so read-only commands can use it too, applyPlan acts on the plan.
+// If voice channels are given, the caller is expected to hold a read lock on configMutex.
+func planText(discord *discordgo.Session, textID snowflake, voiceIDs []snowflake, states []*discordgo.VoiceState, userID snowflake) (*channelPlan, error) {
+	text, err := getChannel(discord, textID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(voiceIDs)
+
+	plan := &channelPlan{text: text, voiceIDs: voiceIDs, access: make(map[snowflake]accessLevel), reevaluate: make(map[snowflake]time.Time)}
+
+	// Exempt members are left alone entirely. Without links, nobody should have access, so nobody is exempt.
+	exempted := make(map[snowflake]bool)
+	isExempt := func(snowflake) bool { return false }
+	if len(voiceIDs) != 0 {
+		exempt := exemptionFor(text.GuildID, voiceIDs)
+		isExempt = func(memberID snowflake) bool {
+			covered, checked := exempted[memberID]
+			if !checked {
+				covered = exempt.covers(discord, text.GuildID, memberID)
+				exempted[memberID] = covered
+				if covered {
+					plan.exempt = append(plan.exempt, memberID)
+				}
+			}
+			return covered
+		}
+	}
+
+	// Find out who should have access, and what access, according to the policy of their voice channel
+	desired := make(map[snowflake]accessLevel)
+	for _, state := range states {
+		if userID != "" && state.UserID != userID {
+			continue
+		}
+		if isExempt(state.UserID) {
+			continue
+		}
+
+		for _, voiceID := range voiceIDs {
+			if state.ChannelID == voiceID {
+				plan.inVoice = append(plan.inVoice, state.UserID)
+			}
+			link, exists := config.Guilds[text.GuildID][voiceID]
+			if !exists {
+				continue
+			}
+			access := link.accessFor(voiceID, state)
+			if access <= desired[state.UserID] {
+				continue
+			}
+			if reason, retryAt := link.checkRequirements(discord, text.GuildID, state.UserID); reason != "" {
+				log.Printf("Withholding access to channel #%s from user %s, because %s.\n", text.Name, getUserName(discord, text.GuildID, state.UserID), reason)
+				plan.withheld = append(plan.withheld, state.UserID)
+				if !retryAt.IsZero() {
+					plan.reevaluateAt(state.UserID, retryAt)
+				}
+				continue
+			}
+			desired[state.UserID] = access
+		}
+	}
+
+	// Guests get access without being in voice, until their pass expires
+	for _, voiceID := range voiceIDs {
+		link, exists := config.Guilds[text.GuildID][voiceID]
+		if !exists {
+			continue
+		}
+
+		for _, guest := range link.Guests {
+			if guest.expired() || (userID != "" && guest.UserID != userID) || isExempt(guest.UserID) || link.findBlock(guest.UserID) != nil {
+				continue
+			}
+			if !containsSnowflake(plan.guests, guest.UserID) {
+				plan.guests = append(plan.guests, guest.UserID)
+			}
+			desired[guest.UserID] = accessFull
+
+			// Take the access away as soon as the pass expires, this also picks up passes after a restart
+			plan.reevaluateAt(guest.UserID, guest.Until)
+		}
+	}
+
+	// Compare that to who actually has access
+	existing := make(map[snowflake]bool)
+	for _, overwrite := range text.PermissionOverwrites {
+		if overwrite.Type != discordgo.PermissionOverwriteTypeMember || (userID != "" && overwrite.ID != userID) || isExempt(overwrite.ID) {
+			continue
+		}
+		existing[overwrite.ID] = true
+
+		access, managed := overwriteAccess(overwrite)
+		switch {
+		case !managed:
+			plan.manual = append(plan.manual, overwrite.ID)
+		case desired[overwrite.ID] == access:
+			plan.granted = append(plan.granted, overwrite.ID)
+		case desired[overwrite.ID] != accessNone:
+			// Their access changed, like being muted by a moderator
+			plan.granted = append(plan.granted, overwrite.ID)
+			plan.missing = append(plan.missing, overwrite.ID)
+			plan.access[overwrite.ID] = desired[overwrite.ID]
+		default:
+			plan.granted = append(plan.granted, overwrite.ID)
+			plan.stale = append(plan.stale, overwrite.ID)
+		}
+	}
+
+	for memberID, access := range desired {
+		if !existing[memberID] && access != accessNone {
+			plan.missing = append(plan.missing, memberID)
+			plan.access[memberID] = access
+		}
+	}
+
+	return plan, nil
+}
+
+// applyPlan creates the missing overwrites and removes the stale ones, and schedules the members whose access changes
+// by itself to be re-evaluated. It returns the members for which the overwrites actually changed.
+func applyPlan(discord *discordgo.Session, guildID snowflake, plan *channelPlan) (added, removed []snowflake) {
+	for _, userID := range plan.stale {
+		log.Printf("Removing override for user %s in channel #%s.\n", getUserName(discord, guildID, userID), plan.text.Name)
+		if err := discord.ChannelPermissionDelete(plan.text.ID, userID); err != nil {
+			log.Println("Could not remove override.", err)
+			continue
+		}
+		removed = append(removed, userID)
+	}
+
+	for _, userID := range plan.missing {
+		var deny int64
+		if plan.access[userID] == accessRead {
+			deny = readOnlyDeny
+		}
+
+		log.Printf("Creating override for user %s in channel #%s.\n", getUserName(discord, guildID, userID), plan.text.Name)
+		if err := discord.ChannelPermissionSet(plan.text.ID, userID, discordgo.PermissionOverwriteTypeMember, discordgo.PermissionViewChannel, deny); err != nil {
+			log.Println("Could not create channel override.", err)
+			continue
+		}
+		added = append(added, userID)
+	}
+
+	for userID, at := range plan.reevaluate {
+		scheduleReevaluation(discord, guildID, plan.text.ID, userID, at)
+	}
+
+	return
+}
+
+// reevaluateAt makes sure the member is re-evaluated at the given time, or earlier
+func (plan *channelPlan) reevaluateAt(userID snowflake, at time.Time) {
+	if earlier, exists := plan.reevaluate[userID]; !exists || at.Before(earlier) {
+		plan.reevaluate[userID] = at
+	}
+}
+
+// inSync checks whether the plan has nothing left to do
+func (plan *channelPlan) inSync() bool {
+	return len(plan.missing) == 0 && len(plan.stale) == 0
+}
+
+// linksSharingText returns the link of the given voice channel, along with the links of all other voice channels
+// linked to the same text channel, as these share the overwrites. Returns false if the voice channel is not linked.
+func linksSharingText(links guildChannels, voiceID snowflake) (guildChannels, bool) {
+	link, exists := links[voiceID]
+	if !exists {
+		return nil, false
+	}
+
+	filtered := guildChannels{voiceID: link}
+	if link.TextChannelID == "" {
+		return filtered, true
+	}
+	for otherID, other := range links {
+		if other.TextChannelID == link.TextChannelID {
+			filtered[otherID] = other
+		}
+	}
+
+	return filtered, true
+}
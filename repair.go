@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func init() {
+	registerCommand(&command{
+		name: "voicelinkrepair",
+		arguments: []argument{
+			{name: "voice", description: "Only repair the link of this voice channel.", typ: argumentVoiceChannel, optional: true},
+			{name: "dry-run", description: "Only report what would be changed, without changing anything.", typ: argumentFlag},
+		},
+		permission: permissionManager,
+		help:       "Brings the access to the linked text channels up to date with who is in voice, and reports what was changed.",
+		handler:    repairCommand,
+	})
+}
+
+func repairCommand(ctx *commandContext) {
+	guild, err := getGuild(ctx.discord, ctx.guildID)
+	if err != nil {
+		ctx.respond("I'm sorry, I could not look up the voice states of this server.")
+		return
+	}
+
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	links := config.Guilds[ctx.guildID]
+	if voice := ctx.channel("voice"); voice != nil {
+		filtered, exists := linksSharingText(links, voice.ID)
+		if !exists {
+			ctx.respond("That is not a registered voice channel in this server.")
+			return
+		}
+		links = filtered
+	}
+
+	plans := planOverwrites(ctx.discord, links, guild.VoiceStates, "")
+	if len(plans) == 0 {
+		if len(links) != 0 {
+			ctx.respond("None of these links have a text channel right now, ephemeral text channels only exist while someone is in voice.")
+		} else {
+			ctx.respond("I know no registered channels for this server.")
+		}
+		return
+	}
+
+	dryRun := ctx.flag("dry-run")
+	message := &discordgo.MessageSend{}
+	length, hidden := 0, 0
+	for _, plan := range plans {
+		if plan.inSync() {
+			continue
+		}
+
+		added, removed := plan.missing, plan.stale
+		if !dryRun {
+			added, removed = applyPlan(ctx.discord, ctx.guildID, plan)
+		}
+
+		embed := renderRepair(plan, added, removed, dryRun)
+		if len(message.Embeds) == maxStatusEmbeds || length+embedLength(embed) > maxEmbedsLength {
+			hidden++
+			continue
+		}
+		length += embedLength(embed)
+		message.Embeds = append(message.Embeds, embed)
+	}
+
+	switch {
+	case len(message.Embeds) == 0:
+		message.Content = "Everything is in order, there is nothing to repair."
+	case dryRun:
+		message.Content = "This is what I would change, nothing has been changed yet:"
+	default:
+		log.Printf("User %s has repaired the links of guild %s.\n", ctx.user.String(), ctx.guildID)
+		message.Content = "I've made the following changes:"
+	}
+	if hidden != 0 {
+		message.Content = fmt.Sprintf("Not showing %d more text channels, use this command with a voice channel to see those. %s", hidden, message.Content)
+	}
+
+	ctx.send(message)
+}
+
+// renderRepair shows the changes made (or that would be made) to a text channel as an embed
+func renderRepair(plan *channelPlan, added, removed []snowflake, dryRun bool) *discordgo.MessageEmbed {
+	addedName, removedName := "Given access", "Access removed"
+	if dryRun {
+		addedName, removedName = "Would give access", "Would remove access"
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title: truncate("#"+plan.text.Name, 256),
+		Color: colorInSync,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: fmt.Sprintf("%s (%d)", addedName, len(added)), Value: mentionList(added, "Nobody", maxFieldLength)},
+			{Name: fmt.Sprintf("%s (%d)", removedName, len(removed)), Value: mentionList(removed, "Nobody", maxFieldLength)},
+		},
+	}
+
+	// Report anything that failed
+	if failed := len(plan.missing) + len(plan.stale) - len(added) - len(removed); failed > 0 {
+		embed.Color = colorOutOfSync
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%d changes failed, check my permissions on this channel.", failed)}
+	}
+
+	return embed
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func init() {
+	registerLinkOption(&linkOption{
+		name:        "requireroles",
+		description: "Members need at least one of these roles to get access to the text channel, separated by spaces.",
+		set: func(ctx *commandContext, link *voiceLink, value string) error {
+			roles, err := parseRoles(ctx, value)
+			if err != nil {
+				return err
+			}
+			link.RequiredRoles = roles
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			return showRoles(link.RequiredRoles)
+		},
+		changed: refreshGuild,
+	})
+
+	registerLinkOption(&linkOption{
+		name:        "blockroles",
+		description: "Members with any of these roles never get access to the text channel, separated by spaces.",
+		set: func(ctx *commandContext, link *voiceLink, value string) error {
+			roles, err := parseRoles(ctx, value)
+			if err != nil {
+				return err
+			}
+			link.BlockedRoles = roles
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			return showRoles(link.BlockedRoles)
+		},
+		changed: refreshGuild,
+	})
+
+	registerLinkOption(&linkOption{
+		name:        "minaccountage",
+		description: "How old the Discord account of members needs to be to get access to the text channel, like `7d`.",
+		set: func(_ *commandContext, link *voiceLink, value string) error {
+			age, err := parseOptionalDuration(value)
+			if err != nil {
+				return err
+			}
+			link.MinAccountAge = age
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			if link.MinAccountAge == 0 {
+				return ""
+			}
+			return formatDuration(link.MinAccountAge)
+		},
+		changed: refreshGuild,
+	})
+
+	registerLinkOption(&linkOption{
+		name:        "minmemberage",
+		description: "How long members need to have been in the server to get access to the text channel, like `1d`.",
+		set: func(_ *commandContext, link *voiceLink, value string) error {
+			age, err := parseOptionalDuration(value)
+			if err != nil {
+				return err
+			}
+			link.MinMemberAge = age
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			if link.MinMemberAge == 0 {
+				return ""
+			}
+			return formatDuration(link.MinMemberAge)
+		},
+		changed: refreshGuild,
+	})
+
+	requireScreening := switchOption("requirescreening", "`on` to only give access to members that completed the membership screening of the server.", func(link *voiceLink) *bool { return &link.RequireScreening })
+	requireScreening.changed = refreshGuild
+	registerLinkOption(requireScreening)
+
+	blockTimeout := switchOption("blocktimeout", "`on` to not give access to members that are timed out, until their timeout ends.", func(link *voiceLink) *bool { return &link.BlockTimeout })
+	blockTimeout.changed = refreshGuild
+	registerLinkOption(blockTimeout)
+
+	discord.AddHandler(onMemberUpdate)
+}
+
+// onMemberUpdate re-evaluates the access of members in voice whenever their roles, screening or timeout change
+func onMemberUpdate(discord *discordgo.Session, event *discordgo.GuildMemberUpdate) {
+	if event.Member == nil || event.User == nil {
+		return
+	}
+
+	reevaluateMember(discord, event.GuildID, event.User.ID)
+}
+
+// reevaluateMember brings the overwrites of a single member up to date with their current voice state
+func reevaluateMember(discord *discordgo.Session, guildID, userID snowflake) {
+	guild, err := getGuild(discord, guildID)
+	if err != nil {
+		log.Println("Couldn't fetch guild.", err)
+		return
+	}
+
+	// Members that are not in voice are planned with an empty voice state, so their access is removed
+	state := &discordgo.VoiceState{GuildID: guildID, UserID: userID}
+	for _, voiceState := range guild.VoiceStates {
+		if voiceState.UserID == userID {
+			state = voiceState
+		}
+	}
+
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	links, exists := config.Guilds[guildID]
+	if !exists {
+		return
+	}
+
+	for _, plan := range planOverwrites(discord, links, []*discordgo.VoiceState{state}, userID) {
+		applyPlan(discord, guildID, plan)
+	}
+}
+
+// scheduleReevaluation re-evaluates the access of the member at the given time, replacing any earlier schedule for
+// the same text channel
+func scheduleReevaluation(discord *discordgo.Session, guildID, textID, userID snowflake, at time.Time) {
+	key := "reevaluate:" + textID + ":" + userID
+	cancelScheduled(key)
+	scheduleOnce(key, time.Until(at)+time.Second, func() {
+		reevaluateMember(discord, guildID, userID)
+	})
+}
+
+// hasRequirements checks whether the link has any requirements members need to meet to get access
+func (link *voiceLink) hasRequirements() bool {
+	return len(link.RequiredRoles) != 0 || len(link.BlockedRoles) != 0 || link.MinAccountAge != 0 ||
+		link.MinMemberAge != 0 || link.RequireScreening || link.BlockTimeout
+}
+
+// checkRequirements returns why the member does not meet the requirements of the link, or an empty string if they do.
+// Members blocked from the link never meet them. If the member will meet them by just waiting, like for a timeout,
+// it also returns when that is.
+func (link *voiceLink) checkRequirements(discord *discordgo.Session, guildID, userID snowflake) (reason string, retryAt time.Time) {
+	if block := link.findBlock(userID); block != nil {
+		if block.Until != nil {
+			return "they are blocked from this link", *block.Until
+		}
+		return "they are blocked from this link", time.Time{}
+	}
+	if !link.hasRequirements() {
+		return "", time.Time{}
+	}
+
+	member, err := getGuildMember(discord, guildID, userID)
+	if err != nil {
+		return "their membership could not be looked up", time.Time{}
+	}
+
+	if len(link.RequiredRoles) != 0 {
+		qualified := false
+		for _, roleID := range member.Roles {
+			qualified = qualified || containsSnowflake(link.RequiredRoles, roleID)
+		}
+		if !qualified {
+			return "they have none of the required roles", time.Time{}
+		}
+	}
+	for _, roleID := range member.Roles {
+		if containsSnowflake(link.BlockedRoles, roleID) {
+			return "they have the blocked role " + roleID, time.Time{}
+		}
+	}
+	if link.RequireScreening && member.Pending {
+		return "they have not completed the membership screening", time.Time{}
+	}
+	if link.BlockTimeout && member.CommunicationDisabledUntil != nil && member.CommunicationDisabledUntil.After(time.Now()) {
+		return "they are timed out", *member.CommunicationDisabledUntil
+	}
+	if link.MinAccountAge != 0 {
+		created, err := discordgo.SnowflakeTimestamp(userID)
+		if qualifies := created.Add(link.MinAccountAge); err == nil && qualifies.After(time.Now()) {
+			return fmt.Sprintf("their account is younger than %s", formatDuration(link.MinAccountAge)), qualifies
+		}
+	}
+	if link.MinMemberAge != 0 && !member.JoinedAt.IsZero() {
+		if qualifies := member.JoinedAt.Add(link.MinMemberAge); qualifies.After(time.Now()) {
+			return fmt.Sprintf("they joined the server less than %s ago", formatDuration(link.MinMemberAge)), qualifies
+		}
+	}
+
+	return "", time.Time{}
+}
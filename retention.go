@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	retentionPurge   = "purge"
+	retentionArchive = "archive"
+
+	// archiveDirectory is where exported messages are written to, relative to the working directory
+	archiveDirectory = "archive"
+	// bulkDeleteAge is how old messages may be to be deleted in bulk, Discord allows 14 days, we keep a margin
+	bulkDeleteAge = 13 * 24 * time.Hour
+	// maxBulkDelete is the amount of messages Discord allows to be deleted in a single request
+	maxBulkDelete = 100
+)
+
+func init() {
+	registerLinkOption(&linkOption{
+		name:        "retention",
+		description: "`purge` to delete the messages in the text channel once everyone has left voice, or `archive` to export them to a file first. `off` to keep them.",
+		set: func(_ *commandContext, link *voiceLink, value string) error {
+			switch strings.ToLower(value) {
+			case "", "off":
+				link.Retention = ""
+			case retentionPurge, retentionArchive:
+				link.Retention = strings.ToLower(value)
+			default:
+				return userError("Please use `purge`, `archive` or `off`.")
+			}
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			return link.Retention
+		},
+	})
+
+	registerLinkOption(&linkOption{
+		name:        "retentiondelay",
+		description: "How long the voice channel has to be empty before the messages are purged, like `15m`. Right away by default.",
+		set: func(_ *commandContext, link *voiceLink, value string) error {
+			delay, err := parseOptionalDuration(value)
+			if err != nil {
+				return err
+			}
+			link.RetentionDelay = delay
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			if link.RetentionDelay == 0 {
+				return ""
+			}
+			return formatDuration(link.RetentionDelay)
+		},
+	})
+
+	onSessionStart(func(_ *discordgo.Session, session *voiceSession) {
+		cancelScheduled("retention:" + session.voiceID)
+	})
+	onSessionEnd(scheduleRetention)
+}
+
+// scheduleRetention schedules the purge of the text channel of a link whose session has ended, if it has a retention
+func scheduleRetention(discord *discordgo.Session, session *voiceSession) {
+	configMutex.RLock()
+	link, exists := config.Guilds[session.guildID][session.voiceID]
+	if !exists || link.Retention == "" || link.TextChannelID == "" {
+		configMutex.RUnlock()
+		return
+	}
+	delay := link.RetentionDelay
+	configMutex.RUnlock()
+
+	scheduleOnce("retention:"+session.voiceID, delay, func() {
+		applyRetention(discord, session.guildID, session.voiceID)
+	})
+}
+
+// applyRetention purges the messages of the linked text channel, exporting them first if the link archives them.
+// Nothing happens if any of the voice channels linked to the same text channel is in use again.
+func applyRetention(discord *discordgo.Session, guildID, voiceID snowflake) {
+	guild, err := getGuild(discord, guildID)
+	if err != nil {
+		log.Println("Couldn't fetch guild.", err)
+		return
+	}
+
+	configMutex.RLock()
+	links, exists := linksSharingText(config.Guilds[guildID], voiceID)
+	if !exists {
+		configMutex.RUnlock()
+		return
+	}
+	link := links[voiceID]
+	mode, textID := link.Retention, link.TextChannelID
+	for otherID := range links {
+		if isOccupied(guild, otherID) {
+			mode = ""
+		}
+	}
+	configMutex.RUnlock()
+
+	if mode == "" || textID == "" {
+		return
+	}
+
+	text, err := getChannel(discord, textID)
+	if err != nil {
+		log.Println("Channel exists in config, but not in state.")
+		return
+	}
+
+	all, err := fetchMessages(discord, textID, time.Time{})
+	if err != nil {
+		log.Println("Could not fetch messages to purge.", err)
+		return
+	}
+
+	var messages []*discordgo.Message
+	for _, message := range all {
+		if !message.Pinned {
+			messages = append(messages, message)
+		}
+	}
+	if len(messages) == 0 {
+		return
+	}
+
+	if mode == retentionArchive {
+		path, err := exportMessages(text, messages)
+		if err != nil {
+			// Better to keep the messages than to lose them
+			log.Println("Could not archive messages, not purging them.", err)
+			return
+		}
+		log.Printf("Archived %d messages of #%s to %s.\n", len(messages), text.Name, path)
+	}
+
+	deleted := purgeMessages(discord, textID, messages)
+	log.Printf("Purged %d messages from #%s.\n", deleted, text.Name)
+}
+
+// fetchMessages returns all messages of the channel sent since the given time, or all of them for a zero time, oldest
+// first.
+func fetchMessages(discord *discordgo.Session, channelID snowflake, since time.Time) ([]*discordgo.Message, error) {
+	var messages []*discordgo.Message
+	before := ""
+	for done := false; !done; {
+		page, err := discord.ChannelMessages(channelID, 100, before, "", "")
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		// Pages are sorted newest first
+		for _, message := range page {
+			if message.Timestamp.Before(since) {
+				done = true
+				break
+			}
+			messages = append(messages, message)
+		}
+		before = page[len(page)-1].ID
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].Timestamp.Before(messages[j].Timestamp)
+	})
+
+	return messages, nil
+}
+
+// purgeMessages deletes the given messages, in bulk where Discord allows it. Returns how many were deleted.
+func purgeMessages(discord *discordgo.Session, channelID snowflake, messages []*discordgo.Message) int {
+	cutoff := time.Now().Add(-bulkDeleteAge)
+	deleted := 0
+
+	var recent []string
+	for _, message := range messages {
+		if message.Timestamp.After(cutoff) {
+			recent = append(recent, message.ID)
+			continue
+		}
+
+		// Older messages can only be deleted one by one
+		if err := discord.ChannelMessageDelete(channelID, message.ID); err != nil {
+			log.Println("Could not delete message.", err)
+			continue
+		}
+		deleted++
+	}
+
+	for len(recent) != 0 {
+		chunk := recent
+		if len(chunk) > maxBulkDelete {
+			chunk = chunk[:maxBulkDelete]
+		}
+		recent = recent[len(chunk):]
+
+		var err error
+		if len(chunk) == 1 {
+			err = discord.ChannelMessageDelete(channelID, chunk[0])
+		} else {
+			err = discord.ChannelMessagesBulkDelete(channelID, chunk)
+		}
+		if err != nil {
+			log.Println("Could not delete messages.", err)
+			continue
+		}
+		deleted += len(chunk)
+	}
+
+	return deleted
+}
+
+// exportMessages writes the messages to a text file in the archive directory, and returns the path of that file
+func exportMessages(text *discordgo.Channel, messages []*discordgo.Message) (string, error) {
+	dir := filepath.Join(archiveDirectory, text.GuildID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s-%d.txt", text.Name, text.ID, time.Now().Unix()))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	for _, message := range messages {
+		line := fmt.Sprintf("[%s] %s: %s", message.Timestamp.UTC().Format("2006-01-02 15:04:05"), message.Author.String(), message.Content)
+		for _, attachment := range message.Attachments {
+			line += " [attachment: " + attachment.URL + "]"
+		}
+		if _, err = fmt.Fprintln(f, line); err != nil {
+			return "", err
+		}
+	}
+
+	return path, nil
+}
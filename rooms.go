@@ -0,0 +1,475 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// The permissions we give ourselves on rooms we create, so we can manage and delete them
+const roomBotPermissions = discordgo.PermissionViewChannel | discordgo.PermissionVoiceConnect |
+	discordgo.PermissionManageChannels | discordgo.PermissionManageRoles | discordgo.PermissionVoiceMoveMembers
+
+// maxUserLimit is the highest user limit Discord allows on a voice channel
+const maxUserLimit = 99
+
+func init() {
+	registerCommand(&command{
+		name: "voicehub",
+		arguments: []argument{
+			{name: "action", description: "Whether to add, remove or list hubs.", typ: argumentString, choices: []string{"add", "remove", "list"}},
+			{name: "voice", description: "The voice channel members join to get their own room.", typ: argumentVoiceChannel, optional: true},
+			{name: "category", description: "The category to create the rooms in, defaults to the category of the hub.", typ: argumentCategory, optional: true},
+		},
+		permission: permissionManager,
+		help:       "Manages the \"join to create\" voice channels, which give everyone joining them their own voice channel with a linked text channel.",
+		handler:    hubCommand,
+	})
+
+	registerCommand(&command{
+		name: "voiceroom",
+		arguments: []argument{
+			{name: "action", description: "What to change about the room you're in.", typ: argumentString, choices: []string{"rename", "lock", "unlock", "limit", "transfer", "claim"}},
+			{name: "value", description: "The new name, the user limit, or the member to transfer the room to.", typ: argumentString, optional: true, rest: true},
+		},
+		permission: permissionEveryone,
+		help:       "Changes the room you own: rename it, lock or unlock it, set a user limit, transfer it to another member, or claim it once its owner has left.",
+		handler:    roomCommand,
+	})
+
+	discord.AddHandler(onRoomVoiceStateUpdate)
+	discord.AddHandler(onRoomChannelRemove)
+	discord.AddHandler(onRoomGuildCreate)
+}
+
+func hubCommand(ctx *commandContext) {
+	voice := ctx.channel("voice")
+
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	settings := getGuildSettings(ctx.guildID)
+
+	switch ctx.arg("action") {
+	case "list":
+		if len(settings.Hubs) == 0 {
+			ctx.respond("There are no hubs in this server.")
+			return
+		}
+
+		response := "These voice channels create a room for everyone joining them:\n"
+		for hubID, hub := range settings.Hubs {
+			response += "\n• <#" + hubID + ">"
+			if hub.CategoryID != "" {
+				response += ", rooms are created in <#" + hub.CategoryID + ">"
+			}
+		}
+		ctx.respond(response)
+	case "add":
+		if voice == nil {
+			ctx.respondError(errUsage)
+			return
+		}
+		if _, isRoom := settings.Rooms[voice.ID]; isRoom {
+			ctx.respond("A room can't be a hub.")
+			return
+		}
+
+		hub := &roomHub{}
+		if category := ctx.channel("category"); category != nil {
+			hub.CategoryID = category.ID
+		}
+		if settings.Hubs == nil {
+			settings.Hubs = make(map[snowflake]*roomHub)
+		}
+		settings.Hubs[voice.ID] = hub
+		go saveConfig()
+
+		log.Printf("User %s has made voice channel %s a hub.\n", ctx.user.String(), voice.Name)
+		ctx.respond("Success! Everyone joining " + voice.Name + " will now get their own room.")
+	case "remove":
+		if voice == nil {
+			ctx.respondError(errUsage)
+			return
+		}
+		if _, isHub := settings.Hubs[voice.ID]; !isHub {
+			ctx.respond(voice.Name + " is not a hub.")
+			return
+		}
+
+		delete(settings.Hubs, voice.ID)
+		go saveConfig()
+
+		log.Printf("User %s has removed hub %s.\n", ctx.user.String(), voice.Name)
+		ctx.respond("Success! " + voice.Name + " is no longer a hub, existing rooms stay until they are empty.")
+	}
+}
+
+func roomCommand(ctx *commandContext) {
+	guild, err := getGuild(ctx.discord, ctx.guildID)
+	if err != nil {
+		ctx.respond("I'm sorry, I could not look up the voice states of this server.")
+		return
+	}
+
+	roomID := voiceChannelOf(guild, ctx.user.ID)
+	configMutex.RLock()
+	var room *tempRoom
+	if settings, exists := config.Settings[ctx.guildID]; exists && roomID != "" {
+		room = settings.Rooms[roomID]
+	}
+	var owner snowflake
+	if room != nil {
+		owner = room.OwnerID
+	}
+	configMutex.RUnlock()
+
+	if room == nil {
+		ctx.respond("You need to be in a room created through a hub to use this command.")
+		return
+	}
+
+	action, value := ctx.arg("action"), ctx.arg("value")
+	if action == "claim" {
+		if voiceChannelOf(guild, owner) == roomID {
+			ctx.respond("The owner of this room is still in it.")
+			return
+		}
+
+		setRoomOwner(ctx.discord, ctx.guildID, roomID, owner, ctx.user.ID)
+		ctx.respond("Success! You now own this room.")
+		return
+	}
+
+	if owner != ctx.user.ID {
+		ctx.respond("Only the owner of this room can do that.")
+		return
+	}
+
+	switch action {
+	case "rename":
+		if value == "" {
+			ctx.respondError(errUsage)
+			return
+		}
+
+		if _, err = ctx.discord.ChannelEdit(roomID, &discordgo.ChannelEdit{Name: truncate(value, 100)}); err != nil {
+			log.Println("Could not rename room.", err)
+			ctx.respond("I'm sorry, I could not rename your room.")
+			return
+		}
+		ctx.respond("Success! Your room has been renamed.")
+	case "lock", "unlock":
+		if err = lockRoom(ctx.discord, guild, roomID, action == "lock"); err != nil {
+			log.Println("Could not change the lock of a room.", err)
+			ctx.respond("I'm sorry, I could not " + action + " your room.")
+			return
+		}
+		if action == "lock" {
+			ctx.respond("Success! Your room is locked, only those in it right now can join it again.")
+		} else {
+			ctx.respond("Success! Your room is unlocked, everyone can join it again.")
+		}
+	case "limit":
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 || limit > maxUserLimit {
+			ctx.respond("Please provide a user limit between 1 and 99, or 0 to remove the limit.")
+			return
+		}
+
+		// ChannelEdit leaves out a limit of 0, so send it ourselves
+		endpoint := discordgo.EndpointChannel(roomID)
+		if _, err = ctx.discord.RequestWithBucketID("PATCH", endpoint, map[string]int{"user_limit": limit}, endpoint); err != nil {
+			log.Println("Could not change the user limit of a room.", err)
+			ctx.respond("I'm sorry, I could not change the user limit of your room.")
+			return
+		}
+		if limit == 0 {
+			ctx.respond("Success! Your room no longer has a user limit.")
+		} else {
+			ctx.respond("Success! Your room now has a limit of " + strconv.Itoa(limit) + " users.")
+		}
+	case "transfer":
+		if value == "" {
+			ctx.respondError(errUsage)
+			return
+		}
+
+		member, err := resolveMember(ctx.discord, ctx.guildID, value)
+		if err != nil {
+			ctx.respondError(err)
+			return
+		}
+		if voiceChannelOf(guild, member.User.ID) != roomID {
+			ctx.respond(member.User.String() + " needs to be in your room to take it over.")
+			return
+		}
+
+		setRoomOwner(ctx.discord, ctx.guildID, roomID, owner, member.User.ID)
+		ctx.respond("Success! " + member.User.String() + " now owns this room.")
+	}
+}
+
+// onRoomVoiceStateUpdate creates a room for members joining a hub, and deletes rooms that have been left empty
+func onRoomVoiceStateUpdate(discord *discordgo.Session, voiceState *discordgo.VoiceStateUpdate) {
+	if voiceState.BeforeUpdate != nil && voiceState.BeforeUpdate.ChannelID != "" && voiceState.BeforeUpdate.ChannelID != voiceState.ChannelID {
+		removeRoomIfEmpty(discord, voiceState.GuildID, voiceState.BeforeUpdate.ChannelID)
+	}
+
+	if voiceState.ChannelID == "" || (voiceState.Member != nil && voiceState.Member.User != nil && voiceState.Member.User.Bot) {
+		return
+	}
+
+	// Only joining the hub creates a room, not muting or streaming while still in it
+	if voiceState.BeforeUpdate != nil && voiceState.BeforeUpdate.ChannelID == voiceState.ChannelID {
+		return
+	}
+
+	configMutex.RLock()
+	var hub *roomHub
+	if settings, exists := config.Settings[voiceState.GuildID]; exists {
+		hub = settings.Hubs[voiceState.ChannelID]
+	}
+	configMutex.RUnlock()
+
+	if hub != nil {
+		createRoom(discord, voiceState.GuildID, voiceState.ChannelID, hub.CategoryID, voiceState.UserID)
+	}
+}
+
+// onRoomChannelRemove forgets about hubs and rooms that have been deleted
+func onRoomChannelRemove(_ *discordgo.Session, event *discordgo.ChannelDelete) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	settings, exists := config.Settings[event.GuildID]
+	if !exists {
+		return
+	}
+
+	_, isHub := settings.Hubs[event.ID]
+	_, isRoom := settings.Rooms[event.ID]
+	if !isHub && !isRoom {
+		return
+	}
+
+	delete(settings.Hubs, event.ID)
+	delete(settings.Rooms, event.ID)
+	go saveConfig()
+}
+
+// onRoomGuildCreate cleans up the rooms that were emptied or deleted while we were offline
+func onRoomGuildCreate(discord *discordgo.Session, event *discordgo.GuildCreate) {
+	configMutex.Lock()
+	settings, exists := config.Settings[event.ID]
+	if !exists || len(settings.Rooms) == 0 {
+		configMutex.Unlock()
+		return
+	}
+
+	var empty []snowflake
+	updated := false
+	for roomID := range settings.Rooms {
+		if _, err := getChannel(discord, roomID); err != nil {
+			// Deleted in the meantime, so forget about the room and its link
+			delete(settings.Rooms, roomID)
+			if links, guildKnown := config.Guilds[event.ID]; guildKnown {
+				releaseEphemeralChannel(discord, roomID, links[roomID])
+				delete(links, roomID)
+				if len(links) == 0 {
+					delete(config.Guilds, event.ID)
+				}
+			}
+			updated = true
+			continue
+		}
+
+		if !isOccupied(event.Guild, roomID) {
+			empty = append(empty, roomID)
+		}
+	}
+	configMutex.Unlock()
+	if updated {
+		go saveConfig()
+	}
+
+	for _, roomID := range empty {
+		deleteRoom(discord, roomID)
+	}
+}
+
+// createRoom creates a room for the member that joined the hub and moves them into it. The room gets an ephemeral
+// link, so its text channel is created as soon as the member is moved in.
+func createRoom(discord *discordgo.Session, guildID, hubID, categoryID, userID snowflake) {
+	hub, err := getChannel(discord, hubID)
+	if err != nil {
+		log.Println("Could not find hub.", err)
+		return
+	}
+	if categoryID == "" {
+		categoryID = hub.ParentID
+	}
+
+	name := "Room"
+	if member, err := getGuildMember(discord, guildID, userID); err == nil {
+		name = member.DisplayName() + "'s room"
+	}
+
+	// Keep the permissions of the category, including those of @everyone
+	overwrites := categoryOverwrites(discord, guildID, categoryID)
+	if category, err := getChannel(discord, categoryID); err == nil {
+		if everyone := getOverwriteByID(category, guildID, discordgo.PermissionOverwriteTypeRole); everyone != nil {
+			copied := *everyone
+			overwrites = append(overwrites, &copied)
+		}
+	}
+	overwrites = append(overwrites,
+		&discordgo.PermissionOverwrite{
+			ID:    userID,
+			Type:  discordgo.PermissionOverwriteTypeMember,
+			Allow: discordgo.PermissionVoiceConnect,
+		},
+		&discordgo.PermissionOverwrite{
+			ID:    discord.State.User.ID,
+			Type:  discordgo.PermissionOverwriteTypeMember,
+			Allow: roomBotPermissions,
+		},
+	)
+
+	room, err := discord.GuildChannelCreateComplex(guildID, discordgo.GuildChannelCreateData{
+		Name:                 truncate(name, 100),
+		Type:                 discordgo.ChannelTypeGuildVoice,
+		ParentID:             categoryID,
+		Bitrate:              hub.Bitrate,
+		PermissionOverwrites: overwrites,
+	})
+	if err != nil {
+		log.Println("Could not create room.", err)
+		return
+	}
+	discord.State.ChannelAdd(room)
+
+	configMutex.Lock()
+	settings := getGuildSettings(guildID)
+	if settings.Rooms == nil {
+		settings.Rooms = make(map[snowflake]*tempRoom)
+	}
+	settings.Rooms[room.ID] = &tempRoom{OwnerID: userID, HubID: hubID, CreatedAt: time.Now()}
+	link := addLink(guildID, room.ID, "", userID)
+	link.Ephemeral = ephemeralDelete
+	configMutex.Unlock()
+	go saveConfig()
+
+	log.Printf("Created room %s for user %s.\n", room.Name, getUserName(discord, guildID, userID))
+	if err = discord.GuildMemberMove(guildID, userID, &room.ID); err != nil {
+		log.Println("Could not move member to their room.", err)
+		deleteRoom(discord, room.ID)
+	}
+}
+
+// removeRoomIfEmpty deletes the voice channel if it is a room and nobody is left in it
+func removeRoomIfEmpty(discord *discordgo.Session, guildID, channelID snowflake) {
+	configMutex.RLock()
+	var isRoom bool
+	if settings, exists := config.Settings[guildID]; exists {
+		_, isRoom = settings.Rooms[channelID]
+	}
+	configMutex.RUnlock()
+	if !isRoom {
+		return
+	}
+
+	guild, err := getGuild(discord, guildID)
+	if err != nil {
+		log.Println("Couldn't fetch guild.", err)
+		return
+	}
+	if isOccupied(guild, channelID) {
+		return
+	}
+
+	deleteRoom(discord, channelID)
+}
+
+// deleteRoom deletes the room. Its link, text channel and our record of it are removed by the channel delete handlers.
+func deleteRoom(discord *discordgo.Session, roomID snowflake) {
+	log.Printf("Deleting empty room %s.\n", roomID)
+	if _, err := discord.ChannelDelete(roomID); err != nil {
+		log.Println("Could not delete room.", err)
+	}
+}
+
+// setRoomOwner gives the room to another member, who can then join it even while it is locked
+func setRoomOwner(discord *discordgo.Session, guildID, roomID, oldOwner, newOwner snowflake) {
+	configMutex.Lock()
+	if settings, exists := config.Settings[guildID]; exists {
+		if room, isRoom := settings.Rooms[roomID]; isRoom {
+			room.OwnerID = newOwner
+		}
+	}
+	configMutex.Unlock()
+	go saveConfig()
+
+	if err := discord.ChannelPermissionSet(roomID, newOwner, discordgo.PermissionOverwriteTypeMember, discordgo.PermissionVoiceConnect, 0); err != nil {
+		log.Println("Could not give the new room owner access.", err)
+	}
+	log.Printf("Room %s has been transferred from %s to %s.\n", roomID, getUserName(discord, guildID, oldOwner), getUserName(discord, guildID, newOwner))
+}
+
+// lockRoom denies or allows @everyone to connect to the room. When locking, those in the room are allowed to connect,
+// so they can come back if they lose their connection.
+func lockRoom(discord *discordgo.Session, guild *discordgo.Guild, roomID snowflake, lock bool) error {
+	room, err := getChannel(discord, roomID)
+	if err != nil {
+		return err
+	}
+
+	// Keep whatever else the @everyone overwrite copied from the category contains
+	var allow, deny int64
+	if everyone := getOverwriteByID(room, guild.ID, discordgo.PermissionOverwriteTypeRole); everyone != nil {
+		allow, deny = everyone.Allow, everyone.Deny
+	}
+
+	if lock {
+		for _, state := range guild.VoiceStates {
+			if state.ChannelID != roomID {
+				continue
+			}
+			if err = discord.ChannelPermissionSet(roomID, state.UserID, discordgo.PermissionOverwriteTypeMember, discordgo.PermissionVoiceConnect, 0); err != nil {
+				return err
+			}
+		}
+
+		return discord.ChannelPermissionSet(roomID, guild.ID, discordgo.PermissionOverwriteTypeRole, allow&^discordgo.PermissionVoiceConnect, deny|discordgo.PermissionVoiceConnect)
+	}
+
+	deny &^= discordgo.PermissionVoiceConnect
+	if allow == 0 && deny == 0 {
+		return discord.ChannelPermissionDelete(roomID, guild.ID)
+	}
+	return discord.ChannelPermissionSet(roomID, guild.ID, discordgo.PermissionOverwriteTypeRole, allow, deny)
+}
+
+// voiceChannelOf returns the voice channel the user is in, or an empty string if they are not in voice
+func voiceChannelOf(guild *discordgo.Guild, userID snowflake) snowflake {
+	for _, state := range guild.VoiceStates {
+		if state.UserID == userID {
+			return state.ChannelID
+		}
+	}
+
+	return ""
+}
+
+// isOccupied checks whether anyone is in the voice channel
+func isOccupied(guild *discordgo.Guild, channelID snowflake) bool {
+	for _, state := range guild.VoiceStates {
+		if state.ChannelID == channelID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// voiceSession is a period in which a linked voice channel is in use, from the first member joining it until the last
+// one leaving it.
+type voiceSession struct {
+	guildID snowflake
+	voiceID snowflake
+	start   time.Time
+	end     time.Time // Zero while the session is still going on
+}
+
+// sessionListener is called when a session starts or ends, without any locks held. Listeners are called one after
+// another, in the order they are registered.
+type sessionListener func(discord *discordgo.Session, session *voiceSession)
+
+var sessionStartListeners, sessionEndListeners []sessionListener
+
+// onSessionStart registers a function to call whenever a linked voice channel starts being used
+func onSessionStart(listener sessionListener) {
+	sessionStartListeners = append(sessionStartListeners, listener)
+}
+
+// onSessionEnd registers a function to call whenever the last member leaves a linked voice channel
+func onSessionEnd(listener sessionListener) {
+	sessionEndListeners = append(sessionEndListeners, listener)
+}
+
+// beforeSessionEnd registers a function to call whenever the last member leaves a linked voice channel, before any of
+// the listeners registered with onSessionEnd. For example because those delete the messages it needs.
+func beforeSessionEnd(listener sessionListener) {
+	sessionEndListeners = append([]sessionListener{listener}, sessionEndListeners...)
+}
+
+// trackSessions starts and ends the sessions of the given linked voice channels, based on whether anyone is in them.
+// If no voice channels are given, all links of the guild are checked. The start of a session is stored in the config,
+// so sessions that ended while we were offline are ended once we're back.
+func trackSessions(discord *discordgo.Session, guildID snowflake, voiceIDs []snowflake) {
+	guild, err := getGuild(discord, guildID)
+	if err != nil {
+		log.Println("Couldn't fetch guild.", err)
+		return
+	}
+
+	configMutex.Lock()
+	links := config.Guilds[guildID]
+	if voiceIDs == nil {
+		for voiceID := range links {
+			voiceIDs = append(voiceIDs, voiceID)
+		}
+	}
+
+	var started, ended []*voiceSession
+	for _, voiceID := range voiceIDs {
+		link, exists := links[voiceID]
+		if !exists {
+			continue
+		}
+
+		occupied := isOccupied(guild, voiceID)
+		switch {
+		case occupied && link.SessionStart == nil:
+			now := time.Now()
+			link.SessionStart = &now
+			started = append(started, &voiceSession{guildID: guildID, voiceID: voiceID, start: now})
+		case !occupied && link.SessionStart != nil:
+			ended = append(ended, &voiceSession{guildID: guildID, voiceID: voiceID, start: *link.SessionStart, end: time.Now()})
+			link.SessionStart = nil
+		}
+	}
+	configMutex.Unlock()
+
+	if len(started) == 0 && len(ended) == 0 {
+		return
+	}
+	go saveConfig()
+
+	// The listeners may take a while, so don't hold up the event that caused this
+	go func() {
+		for _, session := range started {
+			for _, listener := range sessionStartListeners {
+				listener(discord, session)
+			}
+		}
+		for _, session := range ended {
+			for _, listener := range sessionEndListeners {
+				listener(discord, session)
+			}
+		}
+	}()
+}
+
+var (
+	timerMutex sync.Mutex
+	// pendingTimers contains the delayed actions that have not run yet, by the key they were scheduled with
+	pendingTimers = make(map[string]*time.Timer)
+)
+
+// scheduleOnce runs the action after the delay, unless an action with the same key is already pending
+func scheduleOnce(key string, delay time.Duration, action func()) {
+	timerMutex.Lock()
+	defer timerMutex.Unlock()
+
+	if _, pending := pendingTimers[key]; pending {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		timerMutex.Lock()
+		if pendingTimers[key] != timer {
+			// Cancelled and scheduled again in the meantime
+			timerMutex.Unlock()
+			return
+		}
+		delete(pendingTimers, key)
+		timerMutex.Unlock()
+
+		action()
+	})
+	pendingTimers[key] = timer
+}
+
+// cancelScheduled stops the pending action with the given key, if any
+func cancelScheduled(key string) {
+	timerMutex.Lock()
+	defer timerMutex.Unlock()
+
+	if timer, pending := pendingTimers[key]; pending {
+		timer.Stop()
+		delete(pendingTimers, key)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"log"
+	"reflect"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func init() {
+	registerLinkOption(&linkOption{
+		name:        "spectators",
+		description: "Roles that can always read the text channel, without being in voice, separated by spaces.",
+		set: func(ctx *commandContext, link *voiceLink, value string) error {
+			roles, err := parseRoles(ctx, value)
+			if err != nil {
+				return err
+			}
+			if containsSnowflake(roles, ctx.guildID) {
+				return userError("Everyone can't be a spectator, that would make the text channel public.")
+			}
+
+			// The overwrites are brought up to date once the option has changed
+			link.SpectatorRoles = roles
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			return showRoles(link.SpectatorRoles)
+		},
+		changed: refreshGuild,
+	})
+}
+
+// spectatorMutex makes sure only one sync of the spectator overwrites runs at a time, as it records what it did
+var spectatorMutex sync.Mutex
+
+// syncSpectators makes sure the spectator roles of the links of the guild can see the linked text channels, and takes
+// that away again from roles that are no longer spectators. Existing overwrites of those roles are kept, only the
+// permission to see the channel is added to them. That permission is only taken away again if we are the ones that
+// added it, so roles that could already see the channel keep seeing it.
+// The caller should not hold a lock on configMutex, as this makes requests to Discord.
+func syncSpectators(discord *discordgo.Session, guildID snowflake) {
+	spectatorMutex.Lock()
+	defer spectatorMutex.Unlock()
+
+	// Take a snapshot of the spectator roles the text channels should have, and of the ones we gave access before
+	configMutex.RLock()
+	desired := make(map[snowflake][]snowflake)
+	for _, link := range config.Guilds[guildID] {
+		if link.TextChannelID == "" {
+			continue // Ephemeral link without a text channel at the moment
+		}
+		for _, roleID := range link.SpectatorRoles {
+			if !containsSnowflake(desired[link.TextChannelID], roleID) {
+				desired[link.TextChannelID] = append(desired[link.TextChannelID], roleID)
+			}
+		}
+	}
+	previous := make(map[snowflake][]snowflake)
+	for textID, roles := range config.SpectatorGrants[guildID] {
+		previous[textID] = append([]snowflake(nil), roles...)
+	}
+	configMutex.RUnlock()
+
+	granted := make(map[snowflake][]snowflake)
+	for textID, roles := range desired {
+		text, err := getChannel(discord, textID)
+		if err != nil {
+			log.Println("Channel exists in config, but not in state.")
+			for _, roleID := range roles {
+				if containsSnowflake(previous[textID], roleID) {
+					granted[textID] = append(granted[textID], roleID)
+				}
+			}
+			continue
+		}
+
+		for _, roleID := range roles {
+			ours := containsSnowflake(previous[textID], roleID)
+			if grantSpectator(discord, text, roleID, ours) || ours {
+				granted[textID] = append(granted[textID], roleID)
+			}
+		}
+	}
+
+	for textID, roles := range previous {
+		for _, roleID := range roles {
+			if containsSnowflake(desired[textID], roleID) {
+				continue
+			}
+			if !revokeSpectator(discord, textID, roleID) {
+				granted[textID] = append(granted[textID], roleID) // Try again on the next sync
+			}
+		}
+	}
+
+	// Record what we did, only this function changes the grants
+	for textID, roles := range granted {
+		if len(roles) == 0 {
+			delete(granted, textID)
+		}
+	}
+	changed := !reflect.DeepEqual(granted, previous)
+
+	configMutex.Lock()
+	if len(granted) == 0 {
+		delete(config.SpectatorGrants, guildID)
+	} else {
+		config.SpectatorGrants[guildID] = granted
+	}
+	configMutex.Unlock()
+
+	if changed {
+		go saveConfig()
+	}
+}
+
+// grantSpectator makes sure the spectator role can see the text channel, returns whether we gave it that permission.
+// If ours is set, we gave it that permission before, and we give it back if a moderator took it away since.
+func grantSpectator(discord *discordgo.Session, text *discordgo.Channel, roleID snowflake, ours bool) bool {
+	allow, deny := int64(discordgo.PermissionViewChannel), int64(0)
+	if overwrite := getOverwriteByID(text, roleID, discordgo.PermissionOverwriteTypeRole); overwrite != nil {
+		if hasPermission(overwrite.Allow, discordgo.PermissionViewChannel) {
+			return false // It could already see the channel, or we gave it access before
+		}
+		allow, deny = overwrite.Allow|discordgo.PermissionViewChannel, overwrite.Deny&^discordgo.PermissionViewChannel
+	}
+
+	log.Printf("Giving spectator role %s access to channel #%s.\n", roleID, text.Name)
+	if err := discord.ChannelPermissionSet(text.ID, roleID, discordgo.PermissionOverwriteTypeRole, allow, deny); err != nil {
+		log.Println("Could not create spectator override.", err)
+		return false
+	}
+
+	return true
+}
+
+// revokeSpectator takes away the permission to see the text channel we gave the role, leaving the rest of its
+// overwrite alone. The overwrite is only removed if nothing else is left in it. Returns false if this should be
+// tried again later.
+func revokeSpectator(discord *discordgo.Session, textID, roleID snowflake) bool {
+	text, err := getChannel(discord, textID)
+	if err != nil {
+		return true // The channel is gone, and its overwrites with it
+	}
+
+	overwrite := getOverwriteByID(text, roleID, discordgo.PermissionOverwriteTypeRole)
+	if overwrite == nil || !hasPermission(overwrite.Allow, discordgo.PermissionViewChannel) {
+		return true // A moderator already took it away
+	}
+
+	log.Printf("Removing spectator role %s from channel #%s.\n", roleID, text.Name)
+	if allow := overwrite.Allow &^ discordgo.PermissionViewChannel; allow != 0 || overwrite.Deny != 0 {
+		err = discord.ChannelPermissionSet(textID, roleID, discordgo.PermissionOverwriteTypeRole, allow, overwrite.Deny)
+	} else {
+		err = discord.ChannelPermissionDelete(textID, roleID)
+	}
+	if err != nil {
+		log.Println("Could not remove spectator override.", err)
+		return false
+	}
+
+	return true
+}
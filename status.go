@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	maxStatusEmbeds = 10
+	// maxEmbedsLength is the most characters Discord allows in all embeds of a message together
+	maxEmbedsLength = 6000
+	maxFieldLength  = 1024
+	// minFieldLength is what every field of an embed needs at least, to say nobody or how many members there are
+	minFieldLength = 40
+	colorInSync    = 0x57F287
+	colorOutOfSync = 0xFEE75C
+)
+
+func init() {
+	registerCommand(&command{
+		name:    "voicelinkstatus",
+		aliases: []string{"voicestatus"},
+		arguments: []argument{
+			{name: "voice", description: "Only show the status of the link of this voice channel.", typ: argumentVoiceChannel, optional: true},
+		},
+		permission: permissionManager,
+		help:       "Shows who is in voice, who I've given access to the linked text channels, and any differences between the two.",
+		handler:    statusCommand,
+	})
+}
+
+func statusCommand(ctx *commandContext) {
+	guild, err := getGuild(ctx.discord, ctx.guildID)
+	if err != nil {
+		ctx.respond("I'm sorry, I could not look up the voice states of this server.")
+		return
+	}
+
+	configMutex.RLock()
+	links := config.Guilds[ctx.guildID]
+	if voice := ctx.channel("voice"); voice != nil {
+		filtered, exists := linksSharingText(links, voice.ID)
+		if !exists {
+			configMutex.RUnlock()
+			ctx.respond("That is not a registered voice channel in this server.")
+			return
+		}
+		links = filtered
+	}
+
+	plans := planOverwrites(ctx.discord, links, guild.VoiceStates, "")
+	configMutex.RUnlock()
+
+	if len(plans) == 0 {
+		if len(links) != 0 {
+			ctx.respond("None of these links have a text channel right now, ephemeral text channels only exist while someone is in voice.")
+		} else {
+			ctx.respond("I know no registered channels for this server.")
+		}
+		return
+	}
+
+	message := &discordgo.MessageSend{}
+	length := 0
+	for i, plan := range plans {
+		var embed *discordgo.MessageEmbed
+		if i < maxStatusEmbeds {
+			embed = renderPlan(ctx.discord, plan, "Status of #"+plan.text.Name, maxEmbedsLength-length)
+		}
+		if embed == nil {
+			message.Content = fmt.Sprintf("Only showing the first %d text channels, use this command with a voice channel to see the others.", i)
+			break
+		}
+
+		length += embedLength(embed)
+		message.Embeds = append(message.Embeds, embed)
+	}
+
+	ctx.send(message)
+}
+
+// renderPlan shows a plan as an embed, listing what is and what should be. The embed is kept within the given amount
+// of characters by shortening the lists of members, or nil is returned if even that doesn't fit.
+func renderPlan(discord *discordgo.Session, plan *channelPlan, title string, budget int) *discordgo.MessageEmbed {
+	var voices []string
+	for _, voiceID := range plan.voiceIDs {
+		if voice, err := getChannel(discord, voiceID); err == nil {
+			voices = append(voices, "🔊 "+voice.Name)
+		} else {
+			voices = append(voices, "🔊 "+voiceID)
+		}
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       truncate(title, 256),
+		Description: truncate("Linked to "+strings.Join(voices, ", "), maxFieldLength),
+		Color:       colorInSync,
+	}
+	if !plan.inSync() {
+		embed.Color = colorOutOfSync
+	}
+
+	fields := []struct {
+		name  string
+		users []snowflake
+		empty string
+	}{
+		{"In voice", plan.inVoice, "Nobody"},
+		{"Given access by me", plan.granted, "Nobody"},
+		{"Missing access", plan.missing, "Nobody, everyone in voice has access"},
+		{"Should no longer have access", plan.stale, "Nobody"},
+		{"Manual overwrites (left alone)", plan.manual, "None"},
+		{"Exempt (left alone)", plan.exempt, "Nobody"},
+		{"Blocked or not meeting the requirements", plan.withheld, "Nobody"},
+		{"Guests", plan.guests, "Nobody"},
+	}
+	for _, field := range fields {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: fmt.Sprintf("%s (%d)", field.name, len(field.users))})
+	}
+
+	// Every field gets what is left after the ones before it, keeping enough for the ones after it
+	left := budget - embedLength(embed)
+	for i, field := range fields {
+		reserved := minFieldLength * (len(fields) - i - 1)
+		if left-reserved < minFieldLength {
+			return nil
+		}
+
+		limit := left - reserved
+		if limit > maxFieldLength {
+			limit = maxFieldLength
+		}
+		embed.Fields[i].Value = mentionList(field.users, field.empty, limit)
+		left -= utf8.RuneCountInString(embed.Fields[i].Value)
+	}
+
+	return embed
+}
+
+// embedLength counts the characters of an embed the way Discord does for its limit on the embeds of a message
+func embedLength(embed *discordgo.MessageEmbed) int {
+	length := utf8.RuneCountInString(embed.Title) + utf8.RuneCountInString(embed.Description)
+	for _, field := range embed.Fields {
+		length += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	}
+	if embed.Footer != nil {
+		length += utf8.RuneCountInString(embed.Footer.Text)
+	}
+
+	return length
+}
+
+// mentionList formats a list of users as mentions, for use in embeds (where mentions don't ping anyone). If the list
+// is longer than limit characters, the members that don't fit are counted instead, without cutting a mention in half.
+func mentionList(users []snowflake, empty string, limit int) string {
+	if len(users) == 0 {
+		return empty
+	}
+
+	mentions := make([]string, len(users))
+	for i, userID := range users {
+		mentions[i] = "<@" + userID + ">"
+	}
+	if all := strings.Join(mentions, ", "); len(all) <= limit {
+		return all
+	}
+
+	// Take as many mentions as fit while leaving room to say how many are left
+	for shown := len(mentions) - 1; shown > 0; shown-- {
+		list := fmt.Sprintf("%s and %d more", strings.Join(mentions[:shown], ", "), len(mentions)-shown)
+		if len(list) <= limit {
+			return list
+		}
+	}
+
+	return fmt.Sprintf("%d members", len(users))
+}
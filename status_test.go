@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// manyUsers returns the given amount of user IDs of realistic length
+func manyUsers(count int) []snowflake {
+	users := make([]snowflake, count)
+	for i := range users {
+		users[i] = fmt.Sprintf("1%018d", i)
+	}
+
+	return users
+}
+
+func TestMentionList(t *testing.T) {
+	complete := regexp.MustCompile(`^<@\d+>(, <@\d+>)* and \d+ more$`)
+
+	tests := []struct {
+		name  string
+		users []snowflake
+		limit int
+		want  string
+	}{
+		{"nobody", nil, maxFieldLength, "Nobody"},
+		{"one", []snowflake{"1"}, maxFieldLength, "<@1>"},
+		{"all fit", []snowflake{"1", "2", "3"}, maxFieldLength, "<@1>, <@2>, <@3>"},
+		{"exactly fits", []snowflake{"1", "2", "3"}, 16, "<@1>, <@2>, <@3>"},
+		{"one too many", []snowflake{"1", "2", "3", "4"}, 21, "<@1>, <@2> and 2 more"},
+		{"room for the count", []snowflake{"1", "2", "3"}, 15, "<@1> and 2 more"},
+		{"no room at all", []snowflake{"1", "2", "3"}, 14, "3 members"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := mentionList(test.users, "Nobody", test.limit); got != test.want {
+				t.Errorf("mentionList(%q, %d) = %q, want %q", test.users, test.limit, got, test.want)
+			}
+		})
+	}
+
+	for _, limit := range []int{minFieldLength, 100, maxFieldLength} {
+		got := mentionList(manyUsers(200), "Nobody", limit)
+		if len(got) > limit || !complete.MatchString(got) {
+			t.Errorf("mentionList of 200 users within %d characters = %q", limit, got)
+		}
+	}
+}
+
+func TestRenderPlanBudget(t *testing.T) {
+	users := manyUsers(200)
+	plan := &channelPlan{
+		text:     &discordgo.Channel{Name: "squad-1"},
+		inVoice:  users,
+		granted:  users,
+		missing:  users,
+		stale:    users,
+		manual:   users,
+		exempt:   users,
+		withheld: users,
+		guests:   users,
+	}
+
+	length := 0
+	for i := 0; i < maxStatusEmbeds; i++ {
+		embed := renderPlan(nil, plan, "Status of #squad-1", maxEmbedsLength-length)
+		if embed == nil {
+			break
+		}
+		length += embedLength(embed)
+	}
+	if length > maxEmbedsLength {
+		t.Errorf("embeds of %d characters, want at most %d", length, maxEmbedsLength)
+	}
+	if length == 0 {
+		t.Error("not even a single embed was rendered")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// statusUpdateDelay is how long we wait before editing a status message, so a burst of voice state changes results
+// in a single edit
+const statusUpdateDelay = 5 * time.Second
+
+func init() {
+	registerLinkOption(&linkOption{
+		name:        "statusmessage",
+		description: "`on` to keep a pinned message in the text channel listing who is in voice right now.",
+		set: func(ctx *commandContext, link *voiceLink, value string) error {
+			enabled, err := parseSwitch(value)
+			if err != nil {
+				return err
+			}
+
+			// Clean up the message when turning it off, without holding up the config lock
+			if !enabled && link.StatusMessageID != "" {
+				channelID, messageID := link.StatusChannelID, link.StatusMessageID
+				go func() {
+					if err := ctx.discord.ChannelMessageDelete(channelID, messageID); err != nil {
+						log.Println("Could not delete status message.", err)
+					}
+				}()
+				link.StatusMessageID, link.StatusChannelID = "", ""
+			}
+			link.StatusMessage = enabled
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			if !link.StatusMessage {
+				return ""
+			}
+			return "on"
+		},
+		changed: func(ctx *commandContext, voiceID snowflake) {
+			scheduleStatusUpdate(ctx.discord, ctx.guildID, voiceID)
+		},
+	})
+
+	discord.AddHandler(onStatusMessageDelete)
+}
+
+// onStatusMessageDelete recreates status messages that have been deleted
+func onStatusMessageDelete(discord *discordgo.Session, event *discordgo.MessageDelete) {
+	configMutex.RLock()
+	var deleted snowflake
+	for voiceID, link := range config.Guilds[event.GuildID] {
+		if link.StatusMessageID == event.ID {
+			deleted = voiceID
+		}
+	}
+	configMutex.RUnlock()
+
+	if deleted != "" {
+		scheduleStatusUpdate(discord, event.GuildID, deleted)
+	}
+}
+
+// scheduleStatusUpdate updates the status message of the link of the voice channel soon, if it has one
+func scheduleStatusUpdate(discord *discordgo.Session, guildID, voiceID snowflake) {
+	configMutex.RLock()
+	link, exists := config.Guilds[guildID][voiceID]
+	enabled := exists && link.StatusMessage
+	configMutex.RUnlock()
+	if !enabled {
+		return
+	}
+
+	scheduleOnce("status:"+voiceID, statusUpdateDelay, func() {
+		updateStatusMessage(discord, guildID, voiceID)
+	})
+}
+
+// scheduleStatusUpdates updates all status messages of the guild soon, this also recreates the ones deleted while we
+// were offline
+func scheduleStatusUpdates(discord *discordgo.Session, guildID snowflake) {
+	configMutex.RLock()
+	var voiceIDs []snowflake
+	for voiceID := range config.Guilds[guildID] {
+		voiceIDs = append(voiceIDs, voiceID)
+	}
+	configMutex.RUnlock()
+
+	for _, voiceID := range voiceIDs {
+		scheduleStatusUpdate(discord, guildID, voiceID)
+	}
+}
+
+// updateStatusMessage edits the status message of the link of the voice channel, or posts and pins a new one if it
+// doesn't exist (anymore).
+func updateStatusMessage(discord *discordgo.Session, guildID, voiceID snowflake) {
+	guild, err := getGuild(discord, guildID)
+	if err != nil {
+		log.Println("Couldn't fetch guild.", err)
+		return
+	}
+	voice, err := getChannel(discord, voiceID)
+	if err != nil {
+		log.Println("Channel exists in config, but not in state.")
+		return
+	}
+
+	configMutex.RLock()
+	link, exists := config.Guilds[guildID][voiceID]
+	if !exists || !link.StatusMessage || link.TextChannelID == "" {
+		configMutex.RUnlock()
+		return
+	}
+	textID, messageID, sessionStart := link.TextChannelID, link.StatusMessageID, link.SessionStart
+	if link.StatusChannelID != textID {
+		messageID = "" // The text channel has changed, so the old message is of no use
+	}
+	configMutex.RUnlock()
+
+	// Looking up the names of the members can take a request each, so don't hold on to the config while doing so
+	embed := renderStatusMessage(discord, guild, voice, sessionStart)
+
+	if messageID != "" {
+		edit := discordgo.NewMessageEdit(textID, messageID).SetContent("").SetEmbed(embed)
+		if _, err = discord.ChannelMessageEditComplex(edit); err == nil {
+			return
+		}
+		log.Println("Could not edit status message, posting a new one.", err)
+	}
+
+	message, err := discord.ChannelMessageSendEmbed(textID, embed)
+	if err != nil {
+		log.Println("Could not post status message.", err)
+		return
+	}
+	if err = discord.ChannelMessagePin(textID, message.ID); err != nil {
+		log.Println("Could not pin status message.", err)
+	}
+
+	configMutex.Lock()
+	if link, exists := config.Guilds[guildID][voiceID]; exists {
+		link.StatusMessageID, link.StatusChannelID = message.ID, textID
+	}
+	configMutex.Unlock()
+	go saveConfig()
+}
+
+// renderStatusMessage lists the members in the voice channel, along with their mute, deafen and stream state.
+func renderStatusMessage(discord *discordgo.Session, guild *discordgo.Guild, voice *discordgo.Channel, sessionStart *time.Time) *discordgo.MessageEmbed {
+	var lines []string
+	for _, state := range guild.VoiceStates {
+		if state.ChannelID != voice.ID {
+			continue
+		}
+
+		name := getUserName(discord, guild.ID, state.UserID)
+		if member, err := getGuildMember(discord, guild.ID, state.UserID); err == nil {
+			name = member.DisplayName()
+		}
+
+		line := "• " + name
+		if state.Deaf || state.SelfDeaf {
+			line += " 🙉"
+		} else if state.Mute || state.SelfMute || state.Suppress {
+			line += " 🔇"
+		}
+		if state.SelfStream {
+			line += " 🔴"
+		}
+		if state.SelfVideo {
+			line += " 📷"
+		}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+
+	embed := &discordgo.MessageEmbed{
+		Title:     truncate("🔊 "+voice.Name, 256),
+		Color:     colorLinkList,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Footer:    &discordgo.MessageEmbedFooter{Text: "🔇 muted  🙉 deafened  🔴 streaming  📷 camera · Last updated"},
+	}
+
+	if len(lines) == 0 {
+		embed.Description = "Nobody is in voice right now."
+		return embed
+	}
+
+	embed.Description = truncate(strings.Join(lines, "\n"), 4096)
+	embed.Fields = []*discordgo.MessageEmbedField{{Name: "In voice", Value: fmt.Sprintf("%d", len(lines)), Inline: true}}
+	if sessionStart != nil {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Session started",
+			Value:  fmt.Sprintf("<t:%d:R>", sessionStart.Unix()),
+			Inline: true,
+		})
+	}
+
+	return embed
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// transcriptDirectory is where session transcripts are written to, relative to the working directory
+const transcriptDirectory = "transcripts"
+
+// transcriptFormats maps the supported transcript formats to their file extension and content type
+var transcriptFormats = map[string]struct {
+	extension   string
+	contentType string
+}{
+	"markdown": {"md", "text/markdown"},
+	"html":     {"html", "text/html"},
+	"json":     {"json", "application/json"},
+}
+
+// transcript is everything typed in a linked text channel during a single voice session
+type transcript struct {
+	GuildID      snowflake            `json:"guild"`
+	VoiceChannel string               `json:"voiceChannel"`
+	TextChannel  string               `json:"textChannel"`
+	Start        time.Time            `json:"start"`
+	End          time.Time            `json:"end"`
+	Messages     []*transcriptMessage `json:"messages"`
+}
+
+// transcriptMessage is a single message in a transcript
+type transcriptMessage struct {
+	ID          snowflake               `json:"id"`
+	AuthorID    snowflake               `json:"authorId"`
+	Author      string                  `json:"author"`
+	Timestamp   time.Time               `json:"timestamp"`
+	Content     string                  `json:"content"`
+	Attachments []*transcriptAttachment `json:"attachments,omitempty"`
+}
+
+// transcriptAttachment is a file attached to a message in a transcript, the file itself is not copied
+type transcriptAttachment struct {
+	Filename string `json:"filename"`
+	URL      string `json:"url"`
+	Size     int    `json:"size"`
+}
+
+func init() {
+	registerLinkOption(&linkOption{
+		name:        "transcript",
+		description: "`markdown`, `html` or `json` to write a transcript of the text channel after every voice session. `off` to not keep transcripts.",
+		set: func(_ *commandContext, link *voiceLink, value string) error {
+			value = strings.ToLower(value)
+			if value == "" || value == "off" {
+				link.Transcript = ""
+				return nil
+			}
+			if _, known := transcriptFormats[value]; !known {
+				return userError("Please use `markdown`, `html`, `json` or `off`.")
+			}
+
+			link.Transcript = value
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			return link.Transcript
+		},
+	})
+
+	registerLinkOption(&linkOption{
+		name:        "transcriptchannel",
+		description: "The text channel transcripts are posted in, besides being written to a file.",
+		set: func(ctx *commandContext, link *voiceLink, value string) error {
+			if value == "" {
+				link.TranscriptChannelID = ""
+				return nil
+			}
+
+			channel, err := parseChannel(ctx, value, discordgo.ChannelTypeGuildText)
+			if err != nil {
+				return err
+			}
+			link.TranscriptChannelID = channel.ID
+			return nil
+		},
+		show: func(link *voiceLink) string {
+			if link.TranscriptChannelID == "" {
+				return ""
+			}
+			return "<#" + link.TranscriptChannelID + ">"
+		},
+	})
+
+	// The transcript has to be written before the retention purges the messages
+	beforeSessionEnd(writeTranscript)
+}
+
+// writeTranscript collects the messages sent in the linked text channel during the session, writes them to a file
+// and posts that file in the transcript channel, if the link has one.
+func writeTranscript(discord *discordgo.Session, session *voiceSession) {
+	configMutex.RLock()
+	link, exists := config.Guilds[session.guildID][session.voiceID]
+	if !exists || link.Transcript == "" || link.TextChannelID == "" {
+		configMutex.RUnlock()
+		return
+	}
+	format, textID, postTo := link.Transcript, link.TextChannelID, link.TranscriptChannelID
+	configMutex.RUnlock()
+
+	text, err := getChannel(discord, textID)
+	if err != nil {
+		log.Println("Channel exists in config, but not in state.")
+		return
+	}
+	voiceName := session.voiceID
+	if voice, err := getChannel(discord, session.voiceID); err == nil {
+		voiceName = voice.Name
+	}
+
+	messages, err := fetchMessages(discord, textID, session.start)
+	if err != nil {
+		log.Println("Could not fetch messages for transcript.", err)
+		return
+	}
+
+	record := &transcript{GuildID: session.guildID, VoiceChannel: voiceName, TextChannel: text.Name, Start: session.start, End: session.end}
+	for _, message := range messages {
+		if message.Timestamp.After(session.end) {
+			continue
+		}
+
+		entry := &transcriptMessage{
+			ID:        message.ID,
+			AuthorID:  message.Author.ID,
+			Author:    message.Author.String(),
+			Timestamp: message.Timestamp,
+			Content:   message.Content,
+		}
+		for _, attachment := range message.Attachments {
+			entry.Attachments = append(entry.Attachments, &transcriptAttachment{Filename: attachment.Filename, URL: attachment.URL, Size: attachment.Size})
+		}
+		record.Messages = append(record.Messages, entry)
+	}
+
+	// Nothing was typed, so there is nothing to keep
+	if len(record.Messages) == 0 {
+		return
+	}
+
+	content, err := record.render(format)
+	if err != nil {
+		log.Println("Could not render transcript.", err)
+		return
+	}
+
+	dir := filepath.Join(transcriptDirectory, session.guildID)
+	name := fmt.Sprintf("%s-%d.%s", text.Name, session.start.Unix(), transcriptFormats[format].extension)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		log.Println("Could not create transcript directory.", err)
+	} else if err = os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+		log.Println("Could not write transcript.", err)
+	} else {
+		log.Printf("Wrote transcript of %d messages in #%s to %s.\n", len(record.Messages), text.Name, filepath.Join(dir, name))
+	}
+
+	if postTo == "" {
+		return
+	}
+
+	_, err = discord.ChannelMessageSendComplex(postTo, &discordgo.MessageSend{
+		Content: fmt.Sprintf("Transcript of the session in 🔊 %s, from <t:%d:f> to <t:%d:t>, %d messages.",
+			voiceName, session.start.Unix(), session.end.Unix(), len(record.Messages)),
+		Files: []*discordgo.File{{
+			Name:        name,
+			ContentType: transcriptFormats[format].contentType,
+			Reader:      bytes.NewReader(content),
+		}},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Println("Could not post transcript.", err)
+	}
+}
+
+// render formats the transcript as markdown, html or json
+func (record *transcript) render(format string) ([]byte, error) {
+	const timeFormat = "2006-01-02 15:04:05 MST"
+
+	var b strings.Builder
+	switch format {
+	case "json":
+		return json.MarshalIndent(record, "", "    ")
+	case "html":
+		fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>Transcript of #%s</title></head>\n<body>\n", html.EscapeString(record.TextChannel))
+		fmt.Fprintf(&b, "<h1>Transcript of #%s</h1>\n<p>Voice channel %s, from %s to %s.</p>\n", html.EscapeString(record.TextChannel),
+			html.EscapeString(record.VoiceChannel), record.Start.UTC().Format(timeFormat), record.End.UTC().Format(timeFormat))
+		for _, message := range record.Messages {
+			fmt.Fprintf(&b, "<p><strong>%s</strong> <small>%s</small><br>%s", html.EscapeString(message.Author),
+				message.Timestamp.UTC().Format(timeFormat), strings.Replace(html.EscapeString(message.Content), "\n", "<br>", -1))
+			for _, attachment := range message.Attachments {
+				fmt.Fprintf(&b, "<br>📎 <a href=\"%s\">%s</a>", html.EscapeString(attachment.URL), html.EscapeString(attachment.Filename))
+			}
+			b.WriteString("</p>\n")
+		}
+		b.WriteString("</body>\n</html>\n")
+	default:
+		fmt.Fprintf(&b, "# Transcript of #%s\n\nVoice channel %s, from %s to %s.\n", record.TextChannel, record.VoiceChannel,
+			record.Start.UTC().Format(timeFormat), record.End.UTC().Format(timeFormat))
+		for _, message := range record.Messages {
+			fmt.Fprintf(&b, "\n**%s** (%s)\n", message.Author, message.Timestamp.UTC().Format(timeFormat))
+			if message.Content != "" {
+				b.WriteString(message.Content + "\n")
+			}
+			for _, attachment := range message.Attachments {
+				fmt.Fprintf(&b, "- 📎 [%s](%s)\n", attachment.Filename, attachment.URL)
+			}
+		}
+	}
+
+	return []byte(b.String()), nil
+}
@@ -87,9 +87,9 @@ func getRole(discord *discordgo.Session, guildID, roleID snowflake) (*discordgo.
 	return nil, errors.New("role does not exist or is not part of that guild")
 }
 
-// getOverwriteByID will attempt to obtain the PermissionOverwrite instance for the given ID and type ("role" or "user")
+// getOverwriteByID will attempt to obtain the PermissionOverwrite instance for the given ID and type (role or member)
 // Will return nil if no such overwrite exists
-func getOverwriteByID(channel *discordgo.Channel, id snowflake, typ string) *discordgo.PermissionOverwrite {
+func getOverwriteByID(channel *discordgo.Channel, id snowflake, typ discordgo.PermissionOverwriteType) *discordgo.PermissionOverwrite {
 	for _, overwrite := range channel.PermissionOverwrites {
 		if overwrite.Type == typ && overwrite.ID == id {
 			return overwrite
@@ -100,7 +100,7 @@ func getOverwriteByID(channel *discordgo.Channel, id snowflake, typ string) *dis
 }
 
 // computeBasePermissions calculates the permissions a guild member has, outside the scope of a channel
-func computeBasePermissions(discord *discordgo.Session, member *discordgo.Member, guild *discordgo.Guild) (int, error) {
+func computeBasePermissions(discord *discordgo.Session, member *discordgo.Member, guild *discordgo.Guild) (int64, error) {
 	if guild.OwnerID == member.User.ID {
 		return discordgo.PermissionAll, nil
 	}
@@ -128,20 +128,20 @@ func computeBasePermissions(discord *discordgo.Session, member *discordgo.Member
 }
 
 // computeOverwrites calculates the permissions a channel member has, given the guilds base permissions
-func computeOverwrites(basePermissions int, member *discordgo.Member, channel *discordgo.Channel) (int, error) {
+func computeOverwrites(basePermissions int64, member *discordgo.Member, channel *discordgo.Channel) (int64, error) {
 	if basePermissions&discordgo.PermissionAdministrator == discordgo.PermissionAdministrator {
 		return discordgo.PermissionAll, nil
 	}
 
-	everyoneOverwrite := getOverwriteByID(channel, channel.GuildID, "role")
+	everyoneOverwrite := getOverwriteByID(channel, channel.GuildID, discordgo.PermissionOverwriteTypeRole)
 	if everyoneOverwrite != nil {
 		basePermissions &= ^everyoneOverwrite.Deny
 		basePermissions |= everyoneOverwrite.Allow
 	}
 
-	var allow, deny int
+	var allow, deny int64
 	for _, roleID := range member.Roles {
-		overwrite := getOverwriteByID(channel, roleID, "role")
+		overwrite := getOverwriteByID(channel, roleID, discordgo.PermissionOverwriteTypeRole)
 		if overwrite != nil {
 			allow |= overwrite.Allow
 			deny |= overwrite.Deny
@@ -151,7 +151,7 @@ func computeOverwrites(basePermissions int, member *discordgo.Member, channel *d
 	basePermissions &= ^deny
 	basePermissions |= allow
 
-	memberOverwrite := getOverwriteByID(channel, member.User.ID, "user")
+	memberOverwrite := getOverwriteByID(channel, member.User.ID, discordgo.PermissionOverwriteTypeMember)
 	if memberOverwrite != nil {
 		basePermissions &= ^memberOverwrite.Deny
 		basePermissions |= memberOverwrite.Allow
@@ -162,7 +162,7 @@ func computeOverwrites(basePermissions int, member *discordgo.Member, channel *d
 
 // getPermissionsFromMessage is a convenience method that gathers the server and channel permissions for the
 // MessageCreate event.
-func getPermissionsFromMessage(discord *discordgo.Session, event *discordgo.MessageCreate) (server, channel int) {
+func getPermissionsFromMessage(discord *discordgo.Session, event *discordgo.MessageCreate) (server, channel int64) {
 	channelI, err := getChannel(discord, event.ChannelID)
 	if err != nil {
 		log.Println("Could not fetch channel", err)
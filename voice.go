@@ -1,8 +1,6 @@
 package main
 
 import (
-	"log"
-
 	"github.com/bwmarrin/discordgo"
 )
 
@@ -10,77 +8,47 @@ func init() {
 	discord.AddHandler(onVoiceStateUpdate)
 }
 
+// onVoiceStateUpdate is responsible for granting and revoking access to the linked text channels for a single member,
+// whenever they join, leave or move between voice channels or change their deafened state.
 func onVoiceStateUpdate(discord *discordgo.Session, voiceState *discordgo.VoiceStateUpdate) {
-	configMutex.RLock()
-	defer configMutex.RUnlock()
-
-	guild, exists := config.Guilds[voiceState.GuildID]
-	if !exists {
-		return
-	}
-
-	// First, find the channels the user already has overwrites for
-	toRemove := make(map[*discordgo.Channel]bool)
-	for voiceID, textID := range guild {
-		channel, err := getChannel(discord, textID)
-		if err != nil {
-			log.Println("could not check channel overwrites", err)
-			continue
-		}
-
-		overwrite := getOverwriteByID(channel, voiceState.UserID, "member")
-		if overwrite == nil {
-			continue // No overwrites in place, don't need to remove
-		}
-
-		if voiceID == voiceState.ChannelID && !voiceState.Deaf && !voiceState.SelfDeaf {
-			toRemove[channel] = false // We're about to grant access to this channel, so no need to remove it
-			continue
-		}
-
-		_, exists := toRemove[channel]
-		if !exists {
-			toRemove[channel] = true
+	// Create or schedule the removal of ephemeral text channels first, so a new one is there to give access to, and
+	// keep track of the sessions in the voice channels involved
+	var voiceIDs []snowflake
+	if voiceState.ChannelID != "" {
+		voiceIDs = append(voiceIDs, voiceState.ChannelID)
+	}
+	if voiceState.BeforeUpdate != nil && voiceState.BeforeUpdate.ChannelID != "" && voiceState.BeforeUpdate.ChannelID != voiceState.ChannelID {
+		voiceIDs = append(voiceIDs, voiceState.BeforeUpdate.ChannelID)
+	}
+	if len(voiceIDs) != 0 {
+		syncEphemeralChannels(discord, voiceState.GuildID, voiceIDs)
+		trackSessions(discord, voiceState.GuildID, voiceIDs)
+		for _, voiceID := range voiceIDs {
+			scheduleStatusUpdate(discord, voiceState.GuildID, voiceID)
 		}
 	}
 
-	// After finding them, actually remove them
-	for text, remove := range toRemove {
-		if remove {
-			log.Printf("Removing override for user %s in channel #%s.\n", getUserName(discord, voiceState.GuildID, voiceState.UserID), text.Name)
-			if err := discord.ChannelPermissionDelete(text.ID, voiceState.UserID); err != nil {
-				log.Println("Could not remove override.", err)
-			}
+	// Announce the member joining or leaving in the linked text channels
+	if voiceState.BeforeUpdate == nil || voiceState.BeforeUpdate.ChannelID != voiceState.ChannelID {
+		if voiceState.BeforeUpdate != nil && voiceState.BeforeUpdate.ChannelID != "" {
+			queueAnnouncement(discord, voiceState.GuildID, voiceState.BeforeUpdate.ChannelID, voiceState.UserID, false)
+		}
+		if voiceState.ChannelID != "" {
+			queueAnnouncement(discord, voiceState.GuildID, voiceState.ChannelID, voiceState.UserID, true)
 		}
 	}
 
-	// Second, if the user joins a channel, give them access to the linked channel, if registered
-	if voiceState.ChannelID == "" {
-		return // Didn't join
-	}
-
-	if voiceState.Deaf || voiceState.SelfDeaf {
-		return // Don't show channel if the user is deafened.
-	}
+	configMutex.RLock()
+	defer configMutex.RUnlock()
 
-	textID, exists := guild[voiceState.ChannelID]
+	guild, exists := config.Guilds[voiceState.GuildID]
 	if !exists {
-		return // Channel not linked
-	}
-
-	// Check if the overwrite already exists
-	text, err := getChannel(discord, textID)
-	if err != nil {
-		log.Println("Could not fetch voice-chat channel", err)
 		return
 	}
 
-	// Only set read permissions if this member doesn't already have an overwrite
-	overwrite := getOverwriteByID(text, voiceState.UserID, "member")
-	if overwrite == nil {
-		log.Printf("Creating override for user %s in channel #%s.\n", getUserName(discord, voiceState.GuildID, voiceState.UserID), text.Name)
-		if err = discord.ChannelPermissionSet(textID, voiceState.UserID, "member", discordgo.PermissionReadMessages, 0); err != nil {
-			log.Println("Could not create channel override.", err)
-		}
+	// Only look at the overwrites of this member, compared to their new voice state
+	states := []*discordgo.VoiceState{voiceState.VoiceState}
+	for _, plan := range planOverwrites(discord, guild, states, voiceState.UserID) {
+		applyPlan(discord, voiceState.GuildID, plan)
 	}
 }